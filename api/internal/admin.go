@@ -0,0 +1,30 @@
+package internal
+
+import (
+    "net/http"
+)
+
+// DBStats reports the connection pool state from sql.DB.Stats, for checking
+// whether the pool is sized right under load, and the state of the circuit
+// breaker (and the replica's, when there is one).
+func (h *Handler) DBStats(w http.ResponseWriter, r *http.Request) {
+    st := h.DB.Stats()
+    out := map[string]any{
+        "max_open_connections": st.MaxOpenConnections,
+        "open_connections":     st.OpenConnections,
+        "in_use":               st.InUse,
+        "idle":                 st.Idle,
+        "wait_count":           st.WaitCount,
+        "wait_duration_ms":     st.WaitDuration.Milliseconds(),
+        "max_idle_closed":      st.MaxIdleClosed,
+        "max_idle_time_closed": st.MaxIdleTimeClosed,
+        "max_lifetime_closed":  st.MaxLifetimeClosed,
+    }
+    if h.Breaker != nil {
+        out["breaker"] = h.Breaker.State()
+    }
+    if h.ReplicaBreaker != nil && h.Replica != nil {
+        out["replica_breaker"] = h.ReplicaBreaker.State()
+    }
+    writeJSON(w, http.StatusOK, out)
+}
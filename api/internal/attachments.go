@@ -0,0 +1,175 @@
+package internal
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Attachment is the metadata of a document stored elsewhere and linked to a
+// case; the bytes live at URL.
+type Attachment struct {
+    ID          int        `json:"id"`
+    CaseID      int        `json:"case_id"`
+    Filename    string     `json:"filename"`
+    ContentType string     `json:"content_type"`
+    Size        int64      `json:"size"`
+    URL         string     `json:"url"`
+    CreatedAt   *time.Time `json:"created_at"`
+}
+
+// attachmentColumns is the select list matching scanAttachment.
+const attachmentColumns = "id, case_id, filename, content_type, size, url, created_at"
+
+func scanAttachment(row rowScanner) (Attachment, error) {
+    var a Attachment
+    err := row.Scan(&a.ID, &a.CaseID, &a.Filename, &a.ContentType, &a.Size, &a.URL, &a.CreatedAt)
+    return a, err
+}
+
+// attachmentPage is the ListAttachments response envelope.
+type attachmentPage struct {
+    Data     []Attachment `json:"data"`
+    Limit    int          `json:"limit"`
+    Offset   int          `json:"offset"`
+    Total    int          `json:"total"`
+    MaxLimit int          `json:"max_limit"`
+}
+
+type attachmentInput struct {
+    Filename    string `json:"filename" validate:"required,filenamelen"`
+    ContentType string `json:"content_type" validate:"contenttypelen,mediatype"`
+    Size        *int64 `json:"size" validate:"required,min=0"`
+    URL         string `json:"url" validate:"required,urllen,http_url"`
+}
+
+// normalize trims the input in place. A missing content type becomes
+// application/octet-stream.
+func (in *attachmentInput) normalize() {
+    in.Filename = normalizeSpace(in.Filename)
+    in.ContentType = strings.TrimSpace(in.ContentType)
+    if in.ContentType == "" {
+        in.ContentType = "application/octet-stream"
+    }
+    in.URL = strings.TrimSpace(in.URL)
+}
+
+// caseExists reports whether a case with id exists in the caller's org.
+func caseExists(ctx context.Context, q querier, id int) (bool, error) {
+    var one int
+    err := q.QueryRowContext(ctx, `SELECT 1 FROM cases WHERE org_id = ? AND id = ?`, orgFromContext(ctx), id).Scan(&one)
+    if errors.Is(err, sql.ErrNoRows) {
+        return false, nil
+    }
+    return err == nil, err
+}
+
+// CreateAttachment records the metadata of a document for a case. The file
+// itself is stored elsewhere; only its URL is kept.
+func (h *Handler) CreateAttachment(w http.ResponseWriter, r *http.Request) {
+    id, ok := caseID(w, r)
+    if !ok {
+        return
+    }
+    var in attachmentInput
+    if !decodeValid(w, r, &in) {
+        return
+    }
+
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+
+    var a Attachment
+    err := h.WithTx(ctx, func(tx *sql.Tx) error {
+        ok, err := caseExists(ctx, tx, id)
+        if err != nil {
+            return err
+        }
+        if !ok {
+            return ErrNotFound
+        }
+        aid, err := insertID(ctx, tx, `INSERT INTO attachments (case_id, filename, content_type, size, url) VALUES (?, ?, ?, ?, ?)`,
+            id, in.Filename, in.ContentType, *in.Size, in.URL)
+        if err != nil {
+            return err
+        }
+        if a, err = scanAttachment(tx.QueryRowContext(ctx, `SELECT `+attachmentColumns+` FROM attachments WHERE id = ?`, aid)); err != nil {
+            return err
+        }
+        return recordAudit(ctx, tx, "create", "attachment", a.ID, nil, a)
+    })
+    if errors.Is(err, ErrNotFound) {
+        writeError(w, 404, CodeNotFound, "case not found")
+        return
+    }
+    if err != nil {
+        dbError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusCreated, a)
+}
+
+// ListAttachments returns a page of a case's attachments, oldest first.
+// Paging and ?envelope= work as in ListCases; an unknown case is 404.
+func (h *Handler) ListAttachments(w http.ResponseWriter, r *http.Request) {
+    id, ok := caseID(w, r)
+    if !ok {
+        return
+    }
+    pl := h.pageLimits("attachments")
+    limit, offset, err := pl.parse(r)
+    if err != nil {
+        writeError(w, 400, CodeInvalidParameter, err.Error())
+        return
+    }
+    shape, err := parsePageShape(r)
+    if err != nil {
+        writeError(w, 400, CodeInvalidParameter, err.Error())
+        return
+    }
+
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+
+    exists, err := caseExists(ctx, h.ReaderDB(), id)
+    if err != nil {
+        dbError(w, err)
+        return
+    }
+    if !exists {
+        writeError(w, 404, CodeNotFound, "case not found")
+        return
+    }
+
+    page := attachmentPage{Data: []Attachment{}, Limit: limit, Offset: offset, MaxLimit: pl.Max}
+    if err := h.ReaderDB().QueryRowContext(ctx, `SELECT COUNT(*) FROM attachments WHERE case_id = ?`, id).Scan(&page.Total); err != nil {
+        dbError(w, err)
+        return
+    }
+    rows, err := h.ReaderDB().QueryContext(ctx, `SELECT `+attachmentColumns+` FROM attachments WHERE case_id = ? ORDER BY id LIMIT ? OFFSET ?`,
+        id, limit, offset)
+    if err != nil {
+        dbError(w, err)
+        return
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        a, err := scanAttachment(rows)
+        if err != nil {
+            dbError(w, err)
+            return
+        }
+        page.Data = append(page.Data, a)
+    }
+    if err := rows.Err(); err != nil {
+        dbError(w, err)
+        return
+    }
+    w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+    writeJSON(w, http.StatusOK, shapePage(shape, page, page.Data, pl.meta(limit, offset, page.Total)))
+}
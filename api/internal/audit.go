@@ -0,0 +1,155 @@
+package internal
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+type AuditEntry struct {
+    ID        int64           `json:"id"`
+    Actor     string          `json:"actor"`
+    Action    string          `json:"action"`
+    Entity    string          `json:"entity"`
+    EntityID  int             `json:"entity_id"`
+    Before    json.RawMessage `json:"before"`
+    After     json.RawMessage `json:"after"`
+    CreatedAt *time.Time      `json:"created_at"`
+}
+
+// actorFromContext identifies who made a request for the audit log: the
+// User.ID it authenticated as, or "anonymous".
+func actorFromContext(ctx context.Context) string {
+    u, ok := UserFromContext(ctx)
+    if !ok {
+        return "anonymous"
+    }
+    return u.ID
+}
+
+// recordAudit writes an audit row inside tx, so it commits only together with
+// the change it describes. before and after are the entity's state around
+// the change; nil marshals as SQL NULL. The actor and org are taken from
+// ctx.
+func recordAudit(ctx context.Context, tx *sql.Tx, action, entity string, id int, before, after any) error {
+    b, err := auditJSON(before)
+    if err != nil {
+        return err
+    }
+    a, err := auditJSON(after)
+    if err != nil {
+        return err
+    }
+    _, err = tx.ExecContext(ctx, `INSERT INTO audit_log (org_id, actor, action, entity, entity_id, before_json, after_json)
+        VALUES (?, ?, ?, ?, ?, ?, ?)`, orgFromContext(ctx), actorFromContext(ctx), action, entity, id, b, a)
+    return err
+}
+
+func auditJSON(v any) (any, error) {
+    if v == nil {
+        return nil, nil
+    }
+    b, err := json.Marshal(v)
+    if err != nil {
+        return nil, err
+    }
+    return string(b), nil
+}
+
+// auditColumns is the select list matching scanAudit.
+const auditColumns = "id, actor, action, entity, entity_id, before_json, after_json, created_at"
+
+func scanAudit(row rowScanner) (AuditEntry, error) {
+    var e AuditEntry
+    var before, after sql.NullString
+    if err := row.Scan(&e.ID, &e.Actor, &e.Action, &e.Entity, &e.EntityID, &before, &after, &e.CreatedAt); err != nil {
+        return AuditEntry{}, err
+    }
+    e.Before, e.After = rawOrNull(before), rawOrNull(after)
+    return e, nil
+}
+
+// auditPage is the ListAudit response envelope.
+type auditPage struct {
+    Data     []AuditEntry `json:"data"`
+    Limit    int          `json:"limit"`
+    Offset   int          `json:"offset"`
+    Total    int          `json:"total"`
+    MaxLimit int          `json:"max_limit"`
+}
+
+// ListAudit returns audit entries newest first, optionally narrowed with
+// ?entity= and ?entity_id=. Paging and ?envelope= work as in ListCustomers.
+func (h *Handler) ListAudit(w http.ResponseWriter, r *http.Request) {
+    pl := h.pageLimits("audit")
+    limit, offset, err := pl.parse(r)
+    if err != nil {
+        writeError(w, 400, CodeInvalidParameter, err.Error())
+        return
+    }
+    shape, err := parsePageShape(r)
+    if err != nil {
+        writeError(w, 400, CodeInvalidParameter, err.Error())
+        return
+    }
+
+    preds := []string{"org_id = ?"}
+    args := []any{orgFromContext(r.Context())}
+    if v := r.URL.Query().Get("entity"); v != "" {
+        preds = append(preds, "entity = ?")
+        args = append(args, v)
+    }
+    if v := r.URL.Query().Get("entity_id"); v != "" {
+        id, err := strconv.Atoi(v)
+        if err != nil {
+            writeError(w, 400, CodeInvalidParameter, "entity_id must be an integer")
+            return
+        }
+        preds = append(preds, "entity_id = ?")
+        args = append(args, id)
+    }
+    where := " WHERE " + strings.Join(preds, " AND ")
+
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+
+    page := auditPage{Data: []AuditEntry{}, Limit: limit, Offset: offset, MaxLimit: pl.Max}
+    if err := h.ReaderDB().QueryRowContext(ctx, `SELECT COUNT(*) FROM audit_log`+where, args...).Scan(&page.Total); err != nil {
+        dbError(w, err)
+        return
+    }
+
+    rows, err := h.ReaderDB().QueryContext(ctx, `SELECT `+auditColumns+` FROM audit_log`+where+` ORDER BY id DESC LIMIT ? OFFSET ?`,
+        append(args, limit, offset)...)
+    if err != nil {
+        dbError(w, err)
+        return
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        e, err := scanAudit(rows)
+        if err != nil {
+            dbError(w, err)
+            return
+        }
+        page.Data = append(page.Data, e)
+    }
+    if err := rows.Err(); err != nil {
+        dbError(w, err)
+        return
+    }
+    w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+    writeJSON(w, http.StatusOK, shapePage(shape, page, page.Data, pl.meta(limit, offset, page.Total)))
+}
+
+func rawOrNull(s sql.NullString) json.RawMessage {
+    if !s.Valid {
+        return json.RawMessage("null")
+    }
+    return json.RawMessage(s.String)
+}
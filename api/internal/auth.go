@@ -0,0 +1,184 @@
+package internal
+
+import (
+    "context"
+    "crypto/sha256"
+    "crypto/subtle"
+    "encoding/hex"
+    "errors"
+    "net/http"
+    "strings"
+)
+
+type ctxKey int
+
+const (
+    userCtxKey ctxKey = iota
+    requestIDCtxKey
+    validateOnlyCtxKey
+)
+
+// authExemptPaths are reachable without credentials so probes work and the
+// API description can be browsed before a key is issued.
+var authExemptPaths = map[string]bool{
+    "/api/health":       true,
+    "/api/ready":        true,
+    "/api/openapi.json": true,
+    "/api/docs":         true,
+}
+
+// adminPathPrefix marks the routes that act on the whole process rather than
+// one org's data, such as maintenance mode; only admin principals reach them.
+const adminPathPrefix = "/api/admin/"
+
+// defaultOrgID is the org of callers nothing assigns one to: API keys
+// missing from API_KEY_ORGS, JWTs without the org claim, and every request
+// when authentication is disabled. Rows from before orgs belong to it too.
+const defaultOrgID = 1
+
+// User is the principal a request authenticated as.
+type User struct {
+    // ID names the principal in the audit log and the rate limiter:
+    // "key:<fingerprint>" for an API key, "user:<sub>" for a JWT.
+    ID string
+    // OrgID is the organization whose data the principal may see and
+    // change; 0 means defaultOrgID.
+    OrgID int
+    // Admin is set for principals that may call /api/admin/*: an
+    // ADMIN_API_KEYS key, or a JWT with the JWT_ADMIN_ROLE role.
+    Admin bool
+    // Subject and Claims are the JWT's sub and full claim set; they are
+    // empty for API keys.
+    Subject string
+    Claims  map[string]any
+}
+
+// UserFromContext returns the principal the request authenticated as, if
+// any.
+func UserFromContext(ctx context.Context) (User, bool) {
+    u, ok := ctx.Value(userCtxKey).(User)
+    return u, ok
+}
+
+// orgFromContext returns the org a request's reads and writes are scoped to.
+func orgFromContext(ctx context.Context) int {
+    if u, ok := UserFromContext(ctx); ok && u.OrgID != 0 {
+        return u.OrgID
+    }
+    return defaultOrgID
+}
+
+// Errors an Authenticator returns for a token it doesn't accept.
+var (
+    errBadCredentials = errors.New("invalid credentials")
+    errTokenExpired   = errors.New("token expired")
+)
+
+// Authenticator checks one kind of bearer credential.
+type Authenticator interface {
+    // Authenticate returns the principal token identifies, or an error if
+    // token isn't a valid credential of this kind.
+    Authenticate(ctx context.Context, token string) (User, error)
+}
+
+// APIKeys authenticates static API keys.
+type APIKeys struct {
+    keys   []string
+    admins []string
+    // orgs maps a key's fingerprint to its org.
+    orgs map[string]int
+}
+
+// NewAPIKeys accepts keys and the admin keys admins, placing each in the
+// org orgs gives its fingerprint (API_KEY_ORGS) or else in defaultOrgID.
+func NewAPIKeys(keys, admins []string, orgs map[string]int) *APIKeys {
+    return &APIKeys{keys: keys, admins: admins, orgs: orgs}
+}
+
+// Authenticate accepts token if it is one of the keys or admin keys. API
+// keys are secrets, so the principal is named by a short fingerprint of the
+// key.
+func (a *APIKeys) Authenticate(_ context.Context, token string) (User, error) {
+    if k, ok := matchKey(a.keys, token); ok {
+        fp := keyFingerprint(k)
+        return User{ID: "key:" + fp, OrgID: a.orgs[fp]}, nil
+    }
+    if k, ok := matchKey(a.admins, token); ok {
+        fp := keyFingerprint(k)
+        return User{ID: "key:" + fp, OrgID: a.orgs[fp], Admin: true}, nil
+    }
+    return User{}, errBadCredentials
+}
+
+// matchKey returns the key in keys equal to token, comparing in constant
+// time.
+func matchKey(keys []string, token string) (string, bool) {
+    for _, k := range keys {
+        if subtle.ConstantTimeCompare([]byte(token), []byte(k)) == 1 {
+            return k, true
+        }
+    }
+    return "", false
+}
+
+// keyFingerprint is the first 4 bytes of the key's SHA-256 in hex: enough
+// to tell keys apart in logs and config without revealing them.
+func keyFingerprint(k string) string {
+    sum := sha256.Sum256([]byte(k))
+    return hex.EncodeToString(sum[:4])
+}
+
+// RequireAuth rejects requests whose "Authorization: Bearer <token>" header
+// none of auths accepts: 401 when the header is missing or the token has
+// expired, 403 otherwise. Each authenticator is tried in order and the first
+// to accept stores its User in the request context. Under /api/admin/ the
+// User must also be an admin, or the request gets 403. With no
+// authenticators, authentication is disabled, admin routes included.
+func RequireAuth(next http.Handler, auths ...Authenticator) http.Handler {
+    if len(auths) == 0 {
+        return next
+    }
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if authExemptPaths[r.URL.Path] {
+            next.ServeHTTP(w, r)
+            return
+        }
+
+        token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+        if !ok || token == "" {
+            w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+            writeError(w, http.StatusUnauthorized, CodeUnauthorized, "missing bearer API key or token")
+            return
+        }
+        expired := false
+        for _, a := range auths {
+            u, err := a.Authenticate(r.Context(), token)
+            if err == nil {
+                if strings.HasPrefix(r.URL.Path, adminPathPrefix) && !u.Admin {
+                    writeError(w, http.StatusForbidden, CodeForbidden, "admin credentials required")
+                    return
+                }
+                next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userCtxKey, u)))
+                return
+            }
+            expired = expired || errors.Is(err, errTokenExpired)
+        }
+        if expired {
+            w.Header().Set("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+            writeError(w, http.StatusUnauthorized, CodeUnauthorized, "token expired")
+            return
+        }
+        writeError(w, http.StatusForbidden, CodeForbidden, "invalid API key or token")
+    })
+}
+
+// SplitList splits a comma-separated env value, dropping blanks.
+func SplitList(v string) []string {
+    var out []string
+    for _, s := range strings.Split(v, ",") {
+        if s = strings.TrimSpace(s); s != "" {
+            out = append(out, s)
+        }
+    }
+    return out
+}
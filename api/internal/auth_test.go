@@ -0,0 +1,260 @@
+package internal
+
+import (
+    "database/sql/driver"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/golang-jwt/jwt/v5"
+    "github.com/gorilla/mux"
+)
+
+// ownerOrgData answers as a database holding one customer (7) with one case
+// (9), a comment, an attachment and an audit entry, all in org 1. Queries
+// that bind org_id to another org find nothing; queries that don't filter on
+// org at all find org 1's rows, as the real ones would.
+func ownerOrgData(query string, args []driver.Value) fakeResult {
+    mine := true
+    if i := strings.Index(query, "org_id = ?"); i >= 0 {
+        mine = args[strings.Count(query[:i], "?")] == int64(1)
+    }
+    n := int64(0)
+    if mine {
+        n = 1
+    }
+    one := func(row ...driver.Value) fakeResult {
+        if !mine {
+            return fakeResult{}
+        }
+        return fakeResult{rows: [][]driver.Value{row}}
+    }
+    at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+    switch {
+    case strings.HasPrefix(query, "SELECT COUNT(*),"):
+        return fakeResult{rows: [][]driver.Value{{n, n, n}}}
+    case strings.HasPrefix(query, "SELECT COUNT(*)"):
+        return fakeResult{rows: [][]driver.Value{{n}}}
+    case strings.HasPrefix(query, "SELECT COALESCE(AVG("):
+        return fakeResult{rows: [][]driver.Value{{float64(n) * 3600}}}
+    case strings.HasPrefix(query, "SELECT status, COUNT(*)"):
+        return one("open", int64(1))
+    case strings.HasPrefix(query, "SELECT 1 FROM"):
+        return one(int64(1))
+    case strings.HasPrefix(query, "SELECT "+customerColumns):
+        return one(customerRow(7, "Ada", "ada@example.com", 1)...)
+    case strings.HasPrefix(query, "SELECT "+caseColumns):
+        return one(int64(9), int64(7), "Printer on fire", "open", "high", at, at, nil, nil, false, nil)
+    case strings.HasPrefix(query, "SELECT "+commentColumns), strings.HasPrefix(query, "SELECT cc.id"):
+        return one(int64(11), int64(9), "agent", "On it", at)
+    case strings.HasPrefix(query, "SELECT "+attachmentColumns):
+        return one(int64(12), int64(9), "photo.jpg", "image/jpeg", int64(1024), "https://files.example.com/photo.jpg", at)
+    case strings.HasPrefix(query, "SELECT "+auditColumns):
+        return one(int64(13), "key:0000", "create", "customer", int64(7), nil, `{"name":"Ada"}`, at)
+    }
+    return fakeResult{}
+}
+
+// isEmpty reports whether a decoded JSON value holds nothing: zero, an
+// empty array, or an object of empty values.
+func isEmpty(v any) bool {
+    switch v := v.(type) {
+    case nil:
+        return true
+    case float64:
+        return v == 0
+    case []any:
+        return len(v) == 0
+    case map[string]any:
+        for _, x := range v {
+            if !isEmpty(x) {
+                return false
+            }
+        }
+        return true
+    }
+    return false
+}
+
+func TestCrossOrgReads(t *testing.T) {
+    db, _ := newFakeDB(t, ownerOrgData)
+    h := newTestHandler(t, db)
+    r := mux.NewRouter()
+    r.HandleFunc("/api/customers", h.ListCustomers)
+    r.HandleFunc("/api/customers/count", h.CountCustomers)
+    r.HandleFunc("/api/customers/{id}", h.GetCustomer)
+    r.HandleFunc("/api/customers/{id}/cases", h.ListCustomerCases)
+    r.HandleFunc("/api/customers/{id}/timeline", h.CustomerTimeline)
+    r.HandleFunc("/api/cases", h.ListCases)
+    r.HandleFunc("/api/cases/stats", h.CaseStatusCounts)
+    r.HandleFunc("/api/cases/{id}/comments", h.ListComments)
+    r.HandleFunc("/api/cases/{id}/attachments", h.ListAttachments)
+    r.HandleFunc("/api/search", h.Search)
+    r.HandleFunc("/api/stats", h.Stats)
+    keys := NewAPIKeys([]string{"owner-key", "other-key"}, nil, map[string]int{keyFingerprint("other-key"): 2})
+    srv := RequireAuth(r, keys)
+
+    for _, tc := range []struct {
+        path string
+        // fields are the top-level fields that hold org 1's data; "" is
+        // the whole body. Empty for detail reads, which are 404 instead.
+        fields []string
+    }{
+        {"/api/customers/7", nil},
+        {"/api/customers/7/cases", nil},
+        {"/api/customers/7/timeline", nil},
+        {"/api/cases/9/comments", nil},
+        {"/api/cases/9/attachments", nil},
+        {"/api/customers", []string{"data", "total"}},
+        {"/api/customers/count", []string{"total"}},
+        {"/api/cases", []string{"data", "total"}},
+        {"/api/cases/stats", []string{""}},
+        {"/api/search?q=a", []string{"data"}},
+        // The owner asks first, so the other org's stats must not come
+        // from the owner's cache entry.
+        {"/api/stats", []string{"customers", "cases_by_status", "avg_open_case_age_seconds"}},
+    } {
+        for _, key := range []string{"owner-key", "other-key"} {
+            owner := key == "owner-key"
+            rec := httptest.NewRecorder()
+            srv.ServeHTTP(rec, bearer("GET", tc.path, key))
+
+            if tc.fields == nil {
+                want := http.StatusOK
+                if !owner {
+                    want = http.StatusNotFound
+                }
+                if rec.Code != want {
+                    t.Errorf("%s as %s: status %d, want %d: %s", tc.path, key, rec.Code, want, rec.Body)
+                } else if !owner && errorCode(t, rec) != CodeNotFound {
+                    t.Errorf("%s as %s: code %q, want %q", tc.path, key, errorCode(t, rec), CodeNotFound)
+                }
+                continue
+            }
+            if rec.Code != http.StatusOK {
+                t.Errorf("%s as %s: status %d: %s", tc.path, key, rec.Code, rec.Body)
+                continue
+            }
+            var body map[string]any
+            if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+                t.Fatalf("%s as %s: %v", tc.path, key, err)
+            }
+            for _, f := range tc.fields {
+                v := any(body)
+                if f != "" {
+                    v = body[f]
+                }
+                if isEmpty(v) == owner {
+                    t.Errorf("%s as %s: %q is %v; want it empty only for the other org", tc.path, key, f, v)
+                }
+            }
+        }
+    }
+}
+
+// signJWT returns claims as an HS256 token signed with secret, expiring in
+// an hour unless claims set exp.
+func signJWT(t *testing.T, secret string, claims jwt.MapClaims) string {
+    t.Helper()
+    if _, ok := claims["exp"]; !ok {
+        claims["exp"] = time.Now().Add(time.Hour).Unix()
+    }
+    s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return s
+}
+
+func TestRequireAuthAdmin(t *testing.T) {
+    const secret = "jwt-test-secret"
+    jwtAuth := NewJWTAuth(&Config{JWTSecret: secret, JWTOrgClaim: "org_id", JWTRolesClaim: "roles", JWTAdminRole: "admin"})
+    token := func(roles any) string {
+        claims := jwt.MapClaims{"sub": "u1"}
+        if roles != nil {
+            claims["roles"] = roles
+        }
+        return signJWT(t, secret, claims)
+    }
+    keys := NewAPIKeys([]string{"user-key"}, []string{"admin-key"}, nil)
+    srv := RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusNoContent)
+    }), keys, jwtAuth)
+
+    for _, tc := range []struct {
+        name, token string
+        admin       bool
+    }{
+        {"API key", "user-key", false},
+        {"admin API key", "admin-key", true},
+        {"JWT without roles", token(nil), false},
+        {"JWT with other roles", token([]any{"agent", "viewer"}), false},
+        {"JWT with the admin role", token([]any{"agent", "admin"}), true},
+        {"JWT with admin in a role string", token("agent admin"), true},
+        {"JWT with a role like admin", token("administrator"), false},
+    } {
+        for _, path := range []string{"/api/admin/maintenance", "/api/admin/db-stats", "/api/customers"} {
+            rec := httptest.NewRecorder()
+            srv.ServeHTTP(rec, bearer("GET", path, tc.token))
+            want := http.StatusNoContent
+            if strings.HasPrefix(path, adminPathPrefix) && !tc.admin {
+                want = http.StatusForbidden
+            }
+            if rec.Code != want {
+                t.Errorf("%s, %s: status %d, want %d", tc.name, path, rec.Code, want)
+            } else if want == http.StatusForbidden && errorCode(t, rec) != CodeForbidden {
+                t.Errorf("%s, %s: code %q, want %q", tc.name, path, errorCode(t, rec), CodeForbidden)
+            }
+        }
+    }
+}
+
+func TestJWTLongSubject(t *testing.T) {
+    const secret = "jwt-test-secret"
+    db, fake := newFakeDB(t, func(query string, args []driver.Value) fakeResult {
+        switch {
+        case strings.HasPrefix(query, "SELECT 1 FROM cases"):
+            return fakeResult{rows: [][]driver.Value{{int64(1)}}}
+        case strings.HasPrefix(query, "INSERT INTO case_comments"):
+            return fakeResult{affected: 1, insertID: 11}
+        case strings.HasPrefix(query, "SELECT "+commentColumns):
+            return fakeResult{rows: [][]driver.Value{{int64(11), int64(9), "author", "On it", time.Now()}}}
+        }
+        return fakeResult{affected: 1}
+    })
+    h := newTestHandler(t, db)
+    r := mux.NewRouter()
+    r.HandleFunc("/api/cases/{id}/comments", h.CreateComment)
+    srv := RequireAuth(r, NewJWTAuth(&Config{JWTSecret: secret, JWTOrgClaim: "org_id"}))
+
+    maxSub := maxActorLen - len("user:")
+    for _, tc := range []struct {
+        name, sub string
+        status    int
+    }{
+        // Past VARCHAR(64), the old width of case_comments.author.
+        {"long", strings.Repeat("a", 100), http.StatusCreated},
+        {"longest", strings.Repeat("a", maxSub), http.StatusCreated},
+        // Characters are counted, not bytes.
+        {"longest multi-byte", strings.Repeat("é", maxSub), http.StatusCreated},
+        {"too long", strings.Repeat("a", maxSub+1), http.StatusForbidden},
+    } {
+        req := jsonRequest("POST", "/api/cases/9/comments", `{"body": "On it"}`)
+        req.Header.Set("Authorization", "Bearer "+signJWT(t, secret, jwt.MapClaims{"sub": tc.sub}))
+        before := len(fake.Statements())
+        rec := httptest.NewRecorder()
+        srv.ServeHTTP(rec, req)
+        if rec.Code != tc.status {
+            t.Errorf("%s: status %d, want %d: %s", tc.name, rec.Code, tc.status, rec.Body)
+            continue
+        }
+        for _, st := range fake.Statements()[before:] {
+            if strings.HasPrefix(st.Query, "INSERT INTO case_comments") && st.Args[1] != "user:"+tc.sub {
+                t.Errorf("%s: author %v, want the caller's full ID", tc.name, st.Args[1])
+            }
+        }
+    }
+}
@@ -0,0 +1,132 @@
+package internal
+
+import (
+    "context"
+    "database/sql/driver"
+    "errors"
+    "log"
+    "sync"
+    "time"
+)
+
+// ErrCircuitOpen is returned in place of a new DB connection while the
+// breaker is open; dbError answers it with a 503.
+var ErrCircuitOpen = errors.New("database circuit breaker is open")
+
+// Breaker states, as DBStats reports them.
+const (
+    breakerClosed   = "closed"
+    breakerOpen     = "open"
+    breakerHalfOpen = "half_open"
+)
+
+// Breaker stops a pool from dialing a database that is down. After
+// threshold consecutive failed connection attempts it opens, and for
+// cooldown every attempt fails at once with ErrCircuitOpen, so requests get
+// a fast 503 instead of queueing on dials that will time out. Then one
+// attempt is let through as a probe: success closes the breaker, failure
+// opens it for another cooldown. Only dialing is guarded; queries on
+// connections already open are unaffected.
+type Breaker struct {
+    threshold int
+    cooldown  time.Duration
+    name      string
+
+    mu       sync.Mutex
+    state    string
+    failures int
+    openedAt time.Time
+}
+
+// NewBreaker returns a closed breaker; name labels its log lines.
+func NewBreaker(name string, threshold int, cooldown time.Duration) *Breaker {
+    return &Breaker{name: name, threshold: threshold, cooldown: cooldown, state: breakerClosed}
+}
+
+// allow reports whether a connection attempt may go ahead, moving an open
+// breaker whose cooldown has passed to half-open for the probe.
+func (b *Breaker) allow() bool {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    switch b.state {
+    case breakerOpen:
+        if time.Since(b.openedAt) < b.cooldown {
+            return false
+        }
+        b.state = breakerHalfOpen
+        return true
+    case breakerHalfOpen:
+        // The probe is still in flight.
+        return false
+    }
+    return true
+}
+
+// record notes the outcome of an attempt allow let through.
+func (b *Breaker) record(err error) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if err == nil {
+        if b.state != breakerClosed {
+            log.Printf("db %s: circuit breaker closed", b.name)
+        }
+        b.state, b.failures = breakerClosed, 0
+        return
+    }
+    b.failures++
+    if b.state == breakerHalfOpen || b.failures >= b.threshold {
+        if b.state == breakerClosed {
+            log.Printf("db %s: circuit breaker open after %d failed connection attempts: %v", b.name, b.failures, err)
+        }
+        b.state, b.openedAt = breakerOpen, time.Now()
+    }
+}
+
+// abandon undoes allow for an attempt the caller cancelled, which says
+// nothing about the database. A cancelled probe leaves the breaker open, due
+// to probe again on the next attempt.
+func (b *Breaker) abandon() {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if b.state == breakerHalfOpen {
+        b.state = breakerOpen
+    }
+}
+
+// BreakerState is a Breaker's state as DBStats reports it.
+type BreakerState struct {
+    State               string     `json:"state"`
+    ConsecutiveFailures int        `json:"consecutive_failures"`
+    OpenedAt            *time.Time `json:"opened_at"`
+}
+
+// State returns the breaker's current state.
+func (b *Breaker) State() BreakerState {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    st := BreakerState{State: b.state, ConsecutiveFailures: b.failures}
+    if b.state != breakerClosed {
+        t := b.openedAt.UTC()
+        st.OpenedAt = &t
+    }
+    return st
+}
+
+// breakerConnector guards a driver.Connector's dials with a Breaker.
+type breakerConnector struct {
+    driver.Connector
+    b *Breaker
+}
+
+func (c breakerConnector) Connect(ctx context.Context) (driver.Conn, error) {
+    if !c.b.allow() {
+        return nil, ErrCircuitOpen
+    }
+    conn, err := c.Connector.Connect(ctx)
+    if err != nil && ctx.Err() != nil {
+        c.b.abandon()
+        return nil, err
+    }
+    c.b.record(err)
+    return conn, err
+}
@@ -0,0 +1,63 @@
+package internal
+
+import (
+    "net/http"
+    "strconv"
+    "time"
+)
+
+// listCacheHeaders lets a client or CDN reuse a list response for
+// Config.ListCacheMaxAge. An authenticated response is marked private, so
+// only the caller's own cache may store it; with authentication off it is
+// public. lastMod, the newest change among the listed rows, is sent as
+// Last-Modified when set, and a request whose If-Modified-Since is no older
+// gets a bodyless 304, in which case listCacheHeaders reports true and the
+// handler must not write anything more.
+//
+// Removing a row from the list doesn't move lastMod, so a revalidated list
+// can miss a removal; the short max-age bounds how long that lasts.
+func (h *Handler) listCacheHeaders(w http.ResponseWriter, r *http.Request, lastMod time.Time) bool {
+    scope := "public"
+    if _, ok := UserFromContext(r.Context()); ok {
+        scope = "private"
+        w.Header().Add("Vary", "Authorization")
+    }
+    w.Header().Set("Cache-Control", scope+", max-age="+strconv.Itoa(int(h.Config.ListCacheMaxAge.Seconds())))
+    if lastMod.IsZero() {
+        return false
+    }
+    // HTTP dates have whole seconds.
+    lastMod = lastMod.UTC().Truncate(time.Second)
+    w.Header().Set("Last-Modified", lastMod.Format(http.TimeFormat))
+    if ims, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !lastMod.After(ims) {
+        w.WriteHeader(http.StatusNotModified)
+        return true
+    }
+    return false
+}
+
+// customersLastModified is the latest created_at or updated_at among cs.
+func customersLastModified(cs []Customer) time.Time {
+    var last time.Time
+    for _, c := range cs {
+        for _, t := range []*time.Time{c.CreatedAt, c.UpdatedAt} {
+            if t != nil && t.After(last) {
+                last = *t
+            }
+        }
+    }
+    return last
+}
+
+// NoStore marks every response to a POST, PUT, PATCH or DELETE
+// "Cache-Control: no-store", so no cache keeps the result of a write.
+func NoStore(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch r.Method {
+        case http.MethodGet, http.MethodHead, http.MethodOptions:
+        default:
+            w.Header().Set("Cache-Control", "no-store")
+        }
+        next.ServeHTTP(w, r)
+    })
+}
@@ -0,0 +1,807 @@
+package internal
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "slices"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gorilla/mux"
+)
+
+type Case struct {
+    ID              int             `json:"id"`
+    CustomerID      int             `json:"customer_id"`
+    Title           string          `json:"title"`
+    Status          string          `json:"status"`
+    Priority        string          `json:"priority"`
+    CreatedAt       *time.Time      `json:"created_at"`
+    StatusChangedAt *time.Time      `json:"status_changed_at"`
+    // Assignee is the support agent who owns the case, or nil if unassigned.
+    Assignee        *string         `json:"assignee"`
+    // DueAt is the case's SLA deadline, or nil if it has none.
+    DueAt           *time.Time      `json:"due_at"`
+    // IsOverdue is true for a case past DueAt that isn't closed.
+    IsOverdue       bool            `json:"is_overdue"`
+    // Metadata is the team's own fields for the case, a JSON object stored
+    // and returned as sent, or null.
+    Metadata        json.RawMessage `json:"metadata"`
+}
+
+// caseOverdue is the SQL condition for Case.IsOverdue and ?overdue=true, so
+// the flag and the filter always agree.
+const caseOverdue = "(due_at IS NOT NULL AND due_at < NOW() AND status <> 'closed')"
+
+// caseColumns is the select list matching scanCase.
+const caseColumns = "id, customer_id, title, status, priority, created_at, status_changed_at, assignee, due_at, " + caseOverdue + ", metadata"
+
+func scanCase(row rowScanner) (Case, error) {
+    var c Case
+    err := row.Scan(&c.ID, &c.CustomerID, &c.Title, &c.Status, &c.Priority, &c.CreatedAt, &c.StatusChangedAt, &c.Assignee, &c.DueAt, &c.IsOverdue, (*[]byte)(&c.Metadata))
+    return c, err
+}
+
+// caseStatuses is the set of statuses a case may be in.
+var caseStatuses = map[string]bool{
+    "open":        true,
+    "in_progress": true,
+    "closed":      true,
+    "reopened":    true,
+}
+
+const caseStatusList = "open, in_progress, closed, reopened"
+
+// caseTransitions is the case workflow: the statuses each status may move to
+// through UpdateCaseStatus. A closed case has to be reopened before work on
+// it resumes.
+var caseTransitions = map[string][]string{
+    "open":        {"in_progress", "closed"},
+    "in_progress": {"open", "closed"},
+    "closed":      {"reopened"},
+    "reopened":    {"in_progress", "closed"},
+}
+
+// casePriorities lists the priorities from least to most severe; sorting by
+// priority follows this order, not the alphabet.
+var casePriorities = []string{"low", "medium", "high", "urgent"}
+
+const casePriorityList = "low, medium, high, urgent"
+
+// casePriorityRank is an SQL expression ranking priority by severity, 0 for
+// low up, for ORDER BY.
+var casePriorityRank = func() string {
+    var b strings.Builder
+    b.WriteString("CASE priority")
+    for i, p := range casePriorities {
+        fmt.Fprintf(&b, " WHEN '%s' THEN %d", p, i)
+    }
+    b.WriteString(" END")
+    return b.String()
+}()
+
+// caseSortColumns maps the accepted case sort fields to their ORDER BY
+// expressions; like customerSortColumns, only these are interpolated.
+var caseSortColumns = map[string]string{
+    "id":         "id",
+    "created_at": "created_at",
+    "priority":   casePriorityRank,
+    "due_at":     "due_at",
+}
+
+// caseOrder builds the ORDER BY clause (with a leading space) for the ?sort=
+// of a case list: id, created_at, priority or due_at, "-" prefix for
+// descending, default -id. Ties break on id, and cases without a due date
+// sort after the rest either way.
+func caseOrder(sort string) (string, error) {
+    if sort == "" {
+        sort = "-id"
+    }
+    dir := "ASC"
+    if strings.HasPrefix(sort, "-") {
+        sort, dir = sort[1:], "DESC"
+    }
+    col, ok := caseSortColumns[sort]
+    if !ok {
+        return "", errors.New("sort must be one of id, created_at, priority, due_at, optionally prefixed with -")
+    }
+    if col == "id" {
+        return " ORDER BY id " + dir, nil
+    }
+    if sort == "due_at" {
+        return " ORDER BY due_at IS NULL, due_at " + dir + ", id " + dir, nil
+    }
+    return " ORDER BY " + col + " " + dir + ", id " + dir, nil
+}
+
+// casePage is the ListCases response envelope.
+type casePage struct {
+    Data     []Case `json:"data"`
+    Limit    int    `json:"limit"`
+    Offset   int    `json:"offset"`
+    Total    int    `json:"total"`
+    MaxLimit int    `json:"max_limit"`
+}
+
+// ListCases returns a page of cases, newest first, optionally filtered by
+// ?customer_id=, ?status=, ?priority=, ?assignee=, ?unassigned=true and
+// ?overdue=true (past due_at and not closed). ?sort= takes id, created_at,
+// priority (by severity) or due_at, "-" prefix for descending. Paging and ?envelope= work as in ListCustomers.
+func (h *Handler) ListCases(w http.ResponseWriter, r *http.Request) {
+    pl := h.pageLimits("cases")
+    limit, offset, err := pl.parse(r)
+    if err != nil {
+        writeError(w, 400, CodeInvalidParameter, err.Error())
+        return
+    }
+
+    where, args, err := caseFilter(r, 0)
+    if err != nil {
+        writeError(w, 400, CodeInvalidParameter, err.Error())
+        return
+    }
+    order, err := caseOrder(r.URL.Query().Get("sort"))
+    if err != nil {
+        writeError(w, 400, CodeInvalidParameter, err.Error())
+        return
+    }
+
+    shape, err := parsePageShape(r)
+    if err != nil {
+        writeError(w, 400, CodeInvalidParameter, err.Error())
+        return
+    }
+
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+    h.writeCasePage(ctx, w, where, order, args, pl, limit, offset, shape)
+}
+
+// CaseStatusCounts returns how many cases are in each status, as
+// {"open": n, "in_progress": n, ...} with every status present, zero
+// included. It takes ListCases' filters, so ?customer_id= and ?assignee=
+// (or ?unassigned=true) scope it to one customer's or one agent's board.
+func (h *Handler) CaseStatusCounts(w http.ResponseWriter, r *http.Request) {
+    where, args, err := caseFilter(r, 0)
+    if err != nil {
+        writeError(w, 400, CodeInvalidParameter, err.Error())
+        return
+    }
+
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+
+    counts := make(map[string]int, len(caseStatuses))
+    for s := range caseStatuses {
+        counts[s] = 0
+    }
+    rows, err := h.ReaderDB().QueryContext(ctx, `SELECT status, COUNT(*) FROM cases`+where+` GROUP BY status`, args...)
+    if err != nil {
+        dbError(w, err)
+        return
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var status string
+        var n int
+        if err := rows.Scan(&status, &n); err != nil {
+            dbError(w, err)
+            return
+        }
+        counts[status] = n
+    }
+    if err := rows.Err(); err != nil {
+        dbError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, counts)
+}
+
+// ListCustomerCases returns a page of one customer's cases, filtered and
+// paged like ListCases. It is 404 when the customer doesn't exist, so an
+// empty page always means a customer with no cases.
+func (h *Handler) ListCustomerCases(w http.ResponseWriter, r *http.Request) {
+    id, ok := customerID(w, r)
+    if !ok {
+        return
+    }
+    pl := h.pageLimits("cases")
+    limit, offset, err := pl.parse(r)
+    if err != nil {
+        writeError(w, 400, CodeInvalidParameter, err.Error())
+        return
+    }
+
+    where, args, err := caseFilter(r, id)
+    if err != nil {
+        writeError(w, 400, CodeInvalidParameter, err.Error())
+        return
+    }
+    order, err := caseOrder(r.URL.Query().Get("sort"))
+    if err != nil {
+        writeError(w, 400, CodeInvalidParameter, err.Error())
+        return
+    }
+    shape, err := parsePageShape(r)
+    if err != nil {
+        writeError(w, 400, CodeInvalidParameter, err.Error())
+        return
+    }
+
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+    if _, err := h.Customers.Get(ctx, id); err != nil {
+        customerError(w, err)
+        return
+    }
+    h.writeCasePage(ctx, w, where, order, args, pl, limit, offset, shape)
+}
+
+// writeCasePage responds with the page of cases matching where, sorted by
+// order and laid out as shape.
+func (h *Handler) writeCasePage(ctx context.Context, w http.ResponseWriter, where, order string, args []any, pl PageLimits, limit, offset int, shape pageShape) {
+    page := casePage{Data: []Case{}, Limit: limit, Offset: offset, MaxLimit: pl.Max}
+    if err := h.ReaderDB().QueryRowContext(ctx, `SELECT COUNT(*) FROM cases`+where, args...).Scan(&page.Total); err != nil {
+        dbError(w, err)
+        return
+    }
+
+    rows, err := h.ReaderDB().QueryContext(ctx, `SELECT `+caseColumns+` FROM cases`+where+order+` LIMIT ? OFFSET ?`,
+        append(args, limit, offset)...)
+    if err != nil {
+        dbError(w, err)
+        return
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        c, err := scanCase(rows)
+        if err != nil {
+            dbError(w, err)
+            return
+        }
+        page.Data = append(page.Data, c)
+    }
+    if err := rows.Err(); err != nil {
+        dbError(w, err)
+        return
+    }
+    w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+    writeJSON(w, http.StatusOK, shapePage(shape, page, page.Data, pl.meta(limit, offset, page.Total)))
+}
+
+// caseFilter builds the WHERE clause (with a leading space) and its bound
+// arguments from the caller's org and the case list query parameters. A
+// non-zero customerID scopes the list to that customer in place of
+// ?customer_id=.
+func caseFilter(r *http.Request, customerID int) (string, []any, error) {
+    preds := []string{"org_id = ?"}
+    args := []any{orgFromContext(r.Context())}
+
+    if customerID != 0 {
+        preds = append(preds, "customer_id = ?")
+        args = append(args, customerID)
+    } else if v := r.URL.Query().Get("customer_id"); v != "" {
+        id, err := strconv.Atoi(v)
+        if err != nil {
+            return "", nil, errors.New("customer_id must be an integer")
+        }
+        preds = append(preds, "customer_id = ?")
+        args = append(args, id)
+    }
+    if v := r.URL.Query().Get("status"); v != "" {
+        if !caseStatuses[v] {
+            return "", nil, errors.New("status must be one of " + caseStatusList)
+        }
+        preds = append(preds, "status = ?")
+        args = append(args, v)
+    }
+    if v := r.URL.Query().Get("priority"); v != "" {
+        if !slices.Contains(casePriorities, v) {
+            return "", nil, errors.New("priority must be one of " + casePriorityList)
+        }
+        preds = append(preds, "priority = ?")
+        args = append(args, v)
+    }
+    assignee, unassigned := r.URL.Query().Get("assignee"), r.URL.Query().Get("unassigned") == "true"
+    switch {
+    case assignee != "" && unassigned:
+        return "", nil, errors.New("assignee and unassigned cannot be combined")
+    case assignee != "":
+        preds = append(preds, "assignee = ?")
+        args = append(args, assignee)
+    case unassigned:
+        preds = append(preds, "assignee IS NULL")
+    }
+    if r.URL.Query().Get("overdue") == "true" {
+        preds = append(preds, caseOverdue)
+    }
+    metaPreds, metaArgs, err := metadataFilter(r.URL.Query())
+    if err != nil {
+        return "", nil, err
+    }
+    preds, args = append(preds, metaPreds...), append(args, metaArgs...)
+
+    return " WHERE " + strings.Join(preds, " AND "), args, nil
+}
+
+// caseInput is the CreateCase body. The oneof lists must match
+// caseStatuses and casePriorities.
+type caseInput struct {
+    CustomerID int             `json:"customer_id" validate:"required"`
+    Title      string          `json:"title" validate:"required,titlelen"`
+    Status     string          `json:"status" validate:"oneof=open in_progress closed reopened"`
+    Priority   string          `json:"priority" validate:"oneof=low medium high urgent"`
+    DueAt      *time.Time      `json:"due_at"`
+    Metadata   json.RawMessage `json:"metadata,omitempty" validate:"omitempty,jsonobject"`
+}
+
+// normalize trims the title and fills in the default status and priority.
+func (in *caseInput) normalize() {
+    in.Title = normalizeSpace(in.Title)
+    in.Metadata = normalizeMetadata(in.Metadata)
+    if in.Status == "" {
+        in.Status = "open"
+    }
+    if in.Priority == "" {
+        in.Priority = "medium"
+    }
+}
+
+// CreateCase opens a new case for an existing customer. Status defaults to
+// "open" and priority to "medium" when omitted; due_at and metadata are
+// optional.
+func (h *Handler) CreateCase(w http.ResponseWriter, r *http.Request) {
+    var in caseInput
+    if !decodeValid(w, r, &in) {
+        return
+    }
+
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+
+    var exists int
+    err := h.WriterDB().QueryRowContext(ctx, `SELECT 1 FROM customers WHERE org_id = ? AND id = ? AND deleted_at IS NULL`,
+        orgFromContext(ctx), in.CustomerID).Scan(&exists)
+    if errors.Is(err, sql.ErrNoRows) {
+        writeError(w, 400, CodeValidationFailed, "customer_id does not reference an existing customer")
+        return
+    }
+    if err != nil {
+        dbError(w, err)
+        return
+    }
+
+    var c Case
+    err = h.WithTx(ctx, func(tx *sql.Tx) error {
+        id, err := insertID(ctx, tx, `INSERT INTO cases (org_id, customer_id, title, status, priority, due_at, metadata, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, NOW())`,
+            orgFromContext(ctx), in.CustomerID, in.Title, in.Status, in.Priority, in.DueAt, metadataArg(in.Metadata))
+        if err != nil {
+            return err
+        }
+        if c, err = loadCase(ctx, tx, int(id)); err != nil {
+            return err
+        }
+        return recordAudit(ctx, tx, "create", "case", c.ID, nil, c)
+    })
+    if err != nil {
+        dbError(w, err)
+        return
+    }
+    h.caseEvents.publish(orgFromContext(ctx), c)
+    h.Webhooks.caseCreated(ctx, c)
+    writeJSON(w, http.StatusCreated, c)
+}
+
+// lockCase loads a case of the caller's org with a row lock held until tx
+// ends.
+func lockCase(ctx context.Context, tx *sql.Tx, id int) (Case, error) {
+    return scanCase(tx.QueryRowContext(ctx, `SELECT `+caseColumns+` FROM cases WHERE org_id = ? AND id = ? FOR UPDATE`, orgFromContext(ctx), id))
+}
+
+// loadCase loads a case of the caller's org.
+func loadCase(ctx context.Context, q querier, id int) (Case, error) {
+    return scanCase(q.QueryRowContext(ctx, `SELECT `+caseColumns+` FROM cases WHERE org_id = ? AND id = ?`, orgFromContext(ctx), id))
+}
+
+// transitionError rejects a status change the workflow doesn't allow.
+type transitionError struct {
+    from, to string
+}
+
+func (e *transitionError) Error() string {
+    return fmt.Sprintf("a %s case cannot move to %s; allowed next states: %s",
+        e.from, e.to, strings.Join(caseTransitions[e.from], ", "))
+}
+
+// caseStatusInput is the UpdateCaseStatus body; the oneof list must match
+// caseStatuses.
+type caseStatusInput struct {
+    Status string `json:"status" validate:"required,oneof=open in_progress closed reopened"`
+}
+
+// UpdateCaseStatus moves a case to the status in {"status": "..."} if
+// caseTransitions allows it from the current one, stamping status_changed_at.
+// A disallowed move is 409 naming the allowed next states.
+func (h *Handler) UpdateCaseStatus(w http.ResponseWriter, r *http.Request) {
+    id, ok := caseID(w, r)
+    if !ok {
+        return
+    }
+    var in caseStatusInput
+    if !decodeValid(w, r, &in) {
+        return
+    }
+
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+
+    var before, after Case
+    err := h.WithTx(ctx, func(tx *sql.Tx) error {
+        var err error
+        if before, err = lockCase(ctx, tx, id); err != nil {
+            return err
+        }
+        after, err = transitionCase(ctx, tx, before, in.Status)
+        return err
+    })
+    var te *transitionError
+    switch {
+    case errors.Is(err, sql.ErrNoRows):
+        writeError(w, 404, CodeNotFound, "case not found")
+    case errors.As(err, &te):
+        writeError(w, 409, CodeConflict, te.Error())
+    case err != nil:
+        dbError(w, err)
+    default:
+        h.Webhooks.caseStatusChanged(ctx, before, after)
+        writeJSON(w, http.StatusOK, after)
+    }
+}
+
+// transitionCase moves a case locked in tx to status, or returns a
+// *transitionError if the workflow doesn't allow it.
+func transitionCase(ctx context.Context, tx *sql.Tx, before Case, status string) (Case, error) {
+    if !slices.Contains(caseTransitions[before.Status], status) {
+        return Case{}, &transitionError{from: before.Status, to: status}
+    }
+    if _, err := tx.ExecContext(ctx, `UPDATE cases SET status = ?, status_changed_at = NOW() WHERE id = ?`, status, before.ID); err != nil {
+        return Case{}, err
+    }
+    after, err := loadCase(ctx, tx, before.ID)
+    if err != nil {
+        return Case{}, err
+    }
+    return after, recordAudit(ctx, tx, "status", "case", before.ID, before, after)
+}
+
+// casePriorityInput is the UpdateCasePriority body; the oneof list must
+// match casePriorities.
+type casePriorityInput struct {
+    Priority string `json:"priority" validate:"required,oneof=low medium high urgent"`
+}
+
+// UpdateCasePriority sets a case's priority from {"priority": "..."} and
+// returns the updated case.
+func (h *Handler) UpdateCasePriority(w http.ResponseWriter, r *http.Request) {
+    id, ok := caseID(w, r)
+    if !ok {
+        return
+    }
+    var in casePriorityInput
+    if !decodeValid(w, r, &in) {
+        return
+    }
+
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+
+    var after Case
+    err := h.WithTx(ctx, func(tx *sql.Tx) error {
+        before, err := lockCase(ctx, tx, id)
+        if err != nil {
+            return err
+        }
+        if _, err := tx.ExecContext(ctx, `UPDATE cases SET priority = ? WHERE id = ?`, in.Priority, id); err != nil {
+            return err
+        }
+        if after, err = loadCase(ctx, tx, id); err != nil {
+            return err
+        }
+        return recordAudit(ctx, tx, "priority", "case", id, before, after)
+    })
+    if errors.Is(err, sql.ErrNoRows) {
+        writeError(w, 404, CodeNotFound, "case not found")
+        return
+    }
+    if err != nil {
+        dbError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, after)
+}
+
+// SetCaseDue sets a case's due date from {"due_at": "<RFC3339>"}, or clears
+// it with {"due_at": null}, and returns the updated case.
+func (h *Handler) SetCaseDue(w http.ResponseWriter, r *http.Request) {
+    id, ok := caseID(w, r)
+    if !ok {
+        return
+    }
+    var in struct {
+        DueAt optionalTime `json:"due_at"`
+    }
+    if !decodeJSON(w, r, &in) {
+        return
+    }
+    if !in.DueAt.Set {
+        writeError(w, 400, CodeValidationFailed, "due_at is required; send null to clear it")
+        return
+    }
+
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+
+    var after Case
+    err := h.WithTx(ctx, func(tx *sql.Tx) error {
+        before, err := lockCase(ctx, tx, id)
+        if err != nil {
+            return err
+        }
+        if _, err := tx.ExecContext(ctx, `UPDATE cases SET due_at = ? WHERE id = ?`, in.DueAt.Value, id); err != nil {
+            return err
+        }
+        if after, err = loadCase(ctx, tx, id); err != nil {
+            return err
+        }
+        return recordAudit(ctx, tx, "due", "case", id, before, after)
+    })
+    if errors.Is(err, sql.ErrNoRows) {
+        writeError(w, 404, CodeNotFound, "case not found")
+        return
+    }
+    if err != nil {
+        dbError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, after)
+}
+
+// SetCaseMetadata replaces a case's metadata with the object in
+// {"metadata": {...}}, or clears it with {"metadata": null}, and returns the
+// updated case.
+func (h *Handler) SetCaseMetadata(w http.ResponseWriter, r *http.Request) {
+    id, ok := caseID(w, r)
+    if !ok {
+        return
+    }
+    var in struct {
+        Metadata json.RawMessage `json:"metadata" validate:"omitempty,jsonobject"`
+    }
+    if !decodeJSON(w, r, &in) {
+        return
+    }
+    if len(in.Metadata) == 0 {
+        writeError(w, 400, CodeValidationFailed, "metadata is required; send null to clear it")
+        return
+    }
+    in.Metadata = normalizeMetadata(in.Metadata)
+    if err := validateStruct(in); err != nil {
+        validationFailed(w, err)
+        return
+    }
+
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+
+    var after Case
+    err := h.WithTx(ctx, func(tx *sql.Tx) error {
+        before, err := lockCase(ctx, tx, id)
+        if err != nil {
+            return err
+        }
+        if _, err := tx.ExecContext(ctx, `UPDATE cases SET metadata = ? WHERE id = ?`, metadataArg(in.Metadata), id); err != nil {
+            return err
+        }
+        if after, err = loadCase(ctx, tx, id); err != nil {
+            return err
+        }
+        return recordAudit(ctx, tx, "metadata", "case", id, before, after)
+    })
+    if errors.Is(err, sql.ErrNoRows) {
+        writeError(w, 404, CodeNotFound, "case not found")
+        return
+    }
+    if err != nil {
+        dbError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, after)
+}
+
+// assigneeInput is the AssignCase body. Unassigning is DELETE, so the
+// assignee is required.
+type assigneeInput struct {
+    Assignee string `json:"assignee" validate:"required,assigneelen"`
+}
+
+func (in *assigneeInput) normalize() {
+    in.Assignee = normalizeSpace(in.Assignee)
+}
+
+// AssignCase sets or changes the agent who owns a case from
+// {"assignee": "..."} and returns the updated case.
+func (h *Handler) AssignCase(w http.ResponseWriter, r *http.Request) {
+    id, ok := caseID(w, r)
+    if !ok {
+        return
+    }
+    var in assigneeInput
+    if !decodeValid(w, r, &in) {
+        return
+    }
+    h.setAssignee(w, r, id, &in.Assignee)
+}
+
+// UnassignCase clears a case's assignee and returns the updated case.
+func (h *Handler) UnassignCase(w http.ResponseWriter, r *http.Request) {
+    id, ok := caseID(w, r)
+    if !ok {
+        return
+    }
+    h.setAssignee(w, r, id, nil)
+}
+
+// setAssignee stores assignee (nil to unassign) on case id, auditing the
+// change, and responds with the case.
+func (h *Handler) setAssignee(w http.ResponseWriter, r *http.Request, id int, assignee *string) {
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+
+    var after Case
+    err := h.WithTx(ctx, func(tx *sql.Tx) error {
+        before, err := lockCase(ctx, tx, id)
+        if err != nil {
+            return err
+        }
+        if _, err := tx.ExecContext(ctx, `UPDATE cases SET assignee = ? WHERE id = ?`, assignee, id); err != nil {
+            return err
+        }
+        if after, err = loadCase(ctx, tx, id); err != nil {
+            return err
+        }
+        return recordAudit(ctx, tx, "assign", "case", id, before, after)
+    })
+    if errors.Is(err, sql.ErrNoRows) {
+        writeError(w, 404, CodeNotFound, "case not found")
+        return
+    }
+    if err != nil {
+        dbError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, after)
+}
+
+// maxBulkCaseIDs caps how many cases one bulk status change may touch.
+const maxBulkCaseIDs = 500
+
+// bulkStatusResult reports the outcome for one id of a bulk status change:
+// "updated", "skipped" (the transition isn't allowed) or "not_found".
+type bulkStatusResult struct {
+    ID     int    `json:"id"`
+    Result string `json:"result"`
+    Error  string `json:"error,omitempty"`
+}
+
+// bulkStatusInput is the BulkUpdateCaseStatus body; the oneof list must
+// match caseStatuses.
+type bulkStatusInput struct {
+    IDs    []int  `json:"ids" validate:"required,min=1"`
+    Status string `json:"status" validate:"required,oneof=open in_progress closed reopened"`
+}
+
+// BulkUpdateCaseStatus moves every case in {"ids": [...], "status": "..."}
+// to status in one transaction, validating each move as UpdateCaseStatus
+// does. Cases that can't move are skipped rather than failing the batch, and
+// each id's outcome is reported; duplicate ids are reported once.
+func (h *Handler) BulkUpdateCaseStatus(w http.ResponseWriter, r *http.Request) {
+    var in bulkStatusInput
+    if !decodeJSON(w, r, &in) {
+        return
+    }
+    // Too many ids is 413 rather than a validation failure, like any other
+    // oversized request.
+    if len(in.IDs) > maxBulkCaseIDs {
+        writeError(w, http.StatusRequestEntityTooLarge, CodeTooLarge, fmt.Sprintf("at most %d cases may be updated per request", maxBulkCaseIDs))
+        return
+    }
+    if err := checkPayload(&in); err != nil {
+        validationFailed(w, err)
+        return
+    }
+    var ids []int
+    seen := map[int]bool{}
+    for _, id := range in.IDs {
+        if !seen[id] {
+            seen[id] = true
+            ids = append(ids, id)
+        }
+    }
+
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+
+    var results []bulkStatusResult
+    // moved pairs each updated case's before and after, for the webhooks.
+    var moved [][2]Case
+    err := h.WithTx(ctx, func(tx *sql.Tx) error {
+        results = make([]bulkStatusResult, 0, len(ids))
+        moved = nil
+        query := `SELECT ` + caseColumns + ` FROM cases WHERE org_id = ? AND id IN (?` + strings.Repeat(", ?", len(ids)-1) + `) FOR UPDATE`
+        args := []any{orgFromContext(ctx)}
+        for _, id := range ids {
+            args = append(args, id)
+        }
+        rows, err := tx.QueryContext(ctx, query, args...)
+        if err != nil {
+            return err
+        }
+        found := map[int]Case{}
+        for rows.Next() {
+            c, err := scanCase(rows)
+            if err != nil {
+                rows.Close()
+                return err
+            }
+            found[c.ID] = c
+        }
+        rows.Close()
+        if err := rows.Err(); err != nil {
+            return err
+        }
+
+        for _, id := range ids {
+            before, ok := found[id]
+            if !ok {
+                results = append(results, bulkStatusResult{ID: id, Result: "not_found"})
+                continue
+            }
+            after, err := transitionCase(ctx, tx, before, in.Status)
+            var te *transitionError
+            switch {
+            case errors.As(err, &te):
+                results = append(results, bulkStatusResult{ID: id, Result: "skipped", Error: te.Error()})
+            case err != nil:
+                return err
+            default:
+                results = append(results, bulkStatusResult{ID: id, Result: "updated"})
+                moved = append(moved, [2]Case{before, after})
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        dbError(w, err)
+        return
+    }
+    for _, m := range moved {
+        h.Webhooks.caseStatusChanged(ctx, m[0], m[1])
+    }
+    writeJSON(w, http.StatusOK, map[string]any{"results": results})
+}
+
+// caseID parses the {id} route variable of a case route.
+func caseID(w http.ResponseWriter, r *http.Request) (int, bool) {
+    id, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        writeError(w, 400, CodeInvalidParameter, "invalid case id")
+        return 0, false
+    }
+    return id, true
+}
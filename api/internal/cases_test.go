@@ -0,0 +1,84 @@
+package internal
+
+import (
+    "encoding/json"
+    "net/http"
+    "reflect"
+    "slices"
+    "strings"
+    "testing"
+)
+
+// TestCaseOneofTags checks every oneof list of a case payload against
+// caseStatuses and casePriorities, which the rest of the code reads.
+func TestCaseOneofTags(t *testing.T) {
+    var statuses []string
+    for s := range caseStatuses {
+        statuses = append(statuses, s)
+    }
+    want := map[string][]string{"status": statuses, "priority": casePriorities}
+    for _, v := range []any{caseInput{}, caseStatusInput{}, casePriorityInput{}, bulkStatusInput{}} {
+        typ := reflect.TypeOf(v)
+        for i := 0; i < typ.NumField(); i++ {
+            f := typ.Field(i)
+            name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+            for _, rule := range strings.Split(f.Tag.Get("validate"), ",") {
+                list, ok := strings.CutPrefix(rule, "oneof=")
+                if !ok {
+                    continue
+                }
+                got, exp := strings.Fields(list), slices.Clone(want[name])
+                slices.Sort(got)
+                slices.Sort(exp)
+                if !slices.Equal(got, exp) {
+                    t.Errorf("%s.%s: oneof %v, want %v", typ.Name(), f.Name, got, exp)
+                }
+            }
+        }
+    }
+}
+
+func TestCaseUpdateValidation(t *testing.T) {
+    h := &Handler{}
+    tooMany := "[" + strings.Repeat("1, ", maxBulkCaseIDs) + "1]"
+    for _, tc := range []struct {
+        name, pattern string
+        fn            http.HandlerFunc
+        method, path  string
+        body          string
+        status        int
+        code          ErrorCode
+        fields        []string
+    }{
+        {"bad status", "/api/cases/{id}/status", h.UpdateCaseStatus, "PATCH", "/api/cases/9/status", `{"status": "done"}`, 400, CodeValidationFailed, []string{"status"}},
+        {"no status", "/api/cases/{id}/status", h.UpdateCaseStatus, "PATCH", "/api/cases/9/status", `{}`, 400, CodeValidationFailed, []string{"status"}},
+        {"bad priority", "/api/cases/{id}/priority", h.UpdateCasePriority, "PATCH", "/api/cases/9/priority", `{"priority": "meh"}`, 400, CodeValidationFailed, []string{"priority"}},
+        {"blank assignee", "/api/cases/{id}/assignee", h.AssignCase, "PUT", "/api/cases/9/assignee", `{"assignee": "   "}`, 400, CodeValidationFailed, []string{"assignee"}},
+        {"long assignee", "/api/cases/{id}/assignee", h.AssignCase, "PUT", "/api/cases/9/assignee", `{"assignee": "` + strings.Repeat("a", maxAssigneeLen+1) + `"}`, 400, CodeValidationFailed, []string{"assignee"}},
+        // The id is checked before the body is read.
+        {"bad case id", "/api/cases/{id}/assignee", h.AssignCase, "PUT", "/api/cases/x/assignee", `not json`, 400, CodeInvalidParameter, nil},
+        {"bulk, every field bad", "/api/cases/bulk-status", h.BulkUpdateCaseStatus, "POST", "/api/cases/bulk-status", `{"ids": [], "status": "done"}`, 400, CodeValidationFailed, []string{"ids", "status"}},
+        {"bulk, nothing given", "/api/cases/bulk-status", h.BulkUpdateCaseStatus, "POST", "/api/cases/bulk-status", `{}`, 400, CodeValidationFailed, []string{"ids", "status"}},
+        {"bulk, too many ids", "/api/cases/bulk-status", h.BulkUpdateCaseStatus, "POST", "/api/cases/bulk-status", `{"ids": ` + tooMany + `, "status": "done"}`, 413, CodeTooLarge, nil},
+    } {
+        rec := serve(tc.pattern, tc.fn, jsonRequest(tc.method, tc.path, tc.body))
+        if rec.Code != tc.status {
+            t.Errorf("%s: status %d, want %d: %s", tc.name, rec.Code, tc.status, rec.Body)
+            continue
+        }
+        var body errorBody
+        if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+            t.Fatalf("%s: %v", tc.name, err)
+        }
+        if body.Error.Code != tc.code {
+            t.Errorf("%s: code %q, want %q", tc.name, body.Error.Code, tc.code)
+        }
+        var fields []string
+        for _, d := range body.Error.Details {
+            fields = append(fields, d.Field)
+        }
+        if strings.Join(fields, ",") != strings.Join(tc.fields, ",") {
+            t.Errorf("%s: details for %v, want %v: %s", tc.name, fields, tc.fields, rec.Body)
+        }
+    }
+}
@@ -0,0 +1,54 @@
+package internal
+
+// ErrorCode is the machine-readable "code" of an error response. Codes are
+// stable: clients may switch on them, so existing values must never change
+// meaning, only new ones be added. The message beside a code is prose for
+// people and may change at any time.
+type ErrorCode string
+
+const (
+    // CodeInvalidParameter: a query parameter, header or path id is malformed (400).
+    CodeInvalidParameter ErrorCode = "invalid_parameter"
+    // CodeInvalidBody: the body is empty, not JSON, or has a field of the wrong type (400).
+    CodeInvalidBody ErrorCode = "invalid_body"
+    // CodeValidationFailed: the body parsed but a value breaks a rule (400).
+    CodeValidationFailed ErrorCode = "validation_failed"
+    // CodeUnauthorized: no API key was sent (401).
+    CodeUnauthorized ErrorCode = "unauthorized"
+    // CodeForbidden: the API key is not valid (403).
+    CodeForbidden ErrorCode = "forbidden"
+    // CodeNotFound: the addressed resource doesn't exist (404).
+    CodeNotFound ErrorCode = "not_found"
+    // CodeMethodNotAllowed: the path exists but not for this method (405).
+    CodeMethodNotAllowed ErrorCode = "method_not_allowed"
+    // CodeNotAcceptable: Accept rules out every type the endpoint produces (406).
+    CodeNotAcceptable ErrorCode = "not_acceptable"
+    // CodeDuplicate: a unique value, such as a customer email, is taken (409).
+    CodeDuplicate ErrorCode = "duplicate"
+    // CodeConflict: the write clashes with the current state, e.g. a stale
+    // version or a disallowed status transition (409).
+    CodeConflict ErrorCode = "conflict"
+    // CodePreconditionFailed: a conditional request header such as
+    // If-Unmodified-Since doesn't hold (412).
+    CodePreconditionFailed ErrorCode = "precondition_failed"
+    // CodeTooLarge: the body or batch exceeds its limit (413).
+    CodeTooLarge ErrorCode = "too_large"
+    // CodeUnsupportedMediaType: the body isn't declared as application/json (415).
+    CodeUnsupportedMediaType ErrorCode = "unsupported_media_type"
+    // CodeRateLimited: the client exceeded its request rate, or a route its
+    // concurrency limit (429).
+    CodeRateLimited ErrorCode = "rate_limited"
+    // CodeInternal: an unexpected server error (500).
+    CodeInternal ErrorCode = "internal"
+    // CodeDBUnavailable: the database couldn't complete the request right now,
+    // e.g. a deadlock that outlasted the retries; retrying may succeed (503).
+    CodeDBUnavailable ErrorCode = "db_unavailable"
+    // CodeUnavailable: the server is at capacity for this kind of request,
+    // e.g. event streams; retry later (503).
+    CodeUnavailable ErrorCode = "unavailable"
+    // CodeMaintenance: writes are disabled while the service is in
+    // maintenance mode; retry after Retry-After (503).
+    CodeMaintenance ErrorCode = "maintenance"
+    // CodeTimeout: the request or one of its queries ran out of time (503 or 504).
+    CodeTimeout ErrorCode = "timeout"
+)
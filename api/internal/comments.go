@@ -0,0 +1,152 @@
+package internal
+
+import (
+    "database/sql"
+    "errors"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Comment is an agent's note on a case.
+type Comment struct {
+    ID     int `json:"id"`
+    CaseID int `json:"case_id"`
+    // Author is the actorFromContext of the request that posted it.
+    Author    string     `json:"author"`
+    Body      string     `json:"body"`
+    CreatedAt *time.Time `json:"created_at"`
+}
+
+// commentColumns is the select list matching scanComment.
+const commentColumns = "id, case_id, author, body, created_at"
+
+func scanComment(row rowScanner) (Comment, error) {
+    var c Comment
+    err := row.Scan(&c.ID, &c.CaseID, &c.Author, &c.Body, &c.CreatedAt)
+    return c, err
+}
+
+// commentPage is the ListComments response envelope.
+type commentPage struct {
+    Data     []Comment `json:"data"`
+    Limit    int       `json:"limit"`
+    Offset   int       `json:"offset"`
+    Total    int       `json:"total"`
+    MaxLimit int       `json:"max_limit"`
+}
+
+type commentInput struct {
+    Body string `json:"body" validate:"required,commentlen"`
+}
+
+func (in *commentInput) normalize() {
+    in.Body = strings.TrimSpace(in.Body)
+}
+
+// CreateComment adds a note from {"body": "..."} to a case, attributed to
+// the caller (User.ID).
+func (h *Handler) CreateComment(w http.ResponseWriter, r *http.Request) {
+    id, ok := caseID(w, r)
+    if !ok {
+        return
+    }
+    var in commentInput
+    if !decodeValid(w, r, &in) {
+        return
+    }
+
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+
+    var c Comment
+    err := h.WithTx(ctx, func(tx *sql.Tx) error {
+        ok, err := caseExists(ctx, tx, id)
+        if err != nil {
+            return err
+        }
+        if !ok {
+            return ErrNotFound
+        }
+        cid, err := insertID(ctx, tx, `INSERT INTO case_comments (case_id, author, body) VALUES (?, ?, ?)`,
+            id, actorFromContext(ctx), in.Body)
+        if err != nil {
+            return err
+        }
+        if c, err = scanComment(tx.QueryRowContext(ctx, `SELECT `+commentColumns+` FROM case_comments WHERE id = ?`, cid)); err != nil {
+            return err
+        }
+        return recordAudit(ctx, tx, "create", "comment", c.ID, nil, c)
+    })
+    if errors.Is(err, ErrNotFound) {
+        writeError(w, 404, CodeNotFound, "case not found")
+        return
+    }
+    if err != nil {
+        dbError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusCreated, c)
+}
+
+// ListComments returns a page of a case's comments, oldest first. Paging and
+// ?envelope= work as in ListCases; an unknown case is 404.
+func (h *Handler) ListComments(w http.ResponseWriter, r *http.Request) {
+    id, ok := caseID(w, r)
+    if !ok {
+        return
+    }
+    pl := h.pageLimits("comments")
+    limit, offset, err := pl.parse(r)
+    if err != nil {
+        writeError(w, 400, CodeInvalidParameter, err.Error())
+        return
+    }
+    shape, err := parsePageShape(r)
+    if err != nil {
+        writeError(w, 400, CodeInvalidParameter, err.Error())
+        return
+    }
+
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+
+    exists, err := caseExists(ctx, h.ReaderDB(), id)
+    if err != nil {
+        dbError(w, err)
+        return
+    }
+    if !exists {
+        writeError(w, 404, CodeNotFound, "case not found")
+        return
+    }
+
+    page := commentPage{Data: []Comment{}, Limit: limit, Offset: offset, MaxLimit: pl.Max}
+    if err := h.ReaderDB().QueryRowContext(ctx, `SELECT COUNT(*) FROM case_comments WHERE case_id = ?`, id).Scan(&page.Total); err != nil {
+        dbError(w, err)
+        return
+    }
+    rows, err := h.ReaderDB().QueryContext(ctx, `SELECT `+commentColumns+` FROM case_comments WHERE case_id = ? ORDER BY id LIMIT ? OFFSET ?`,
+        id, limit, offset)
+    if err != nil {
+        dbError(w, err)
+        return
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        c, err := scanComment(rows)
+        if err != nil {
+            dbError(w, err)
+            return
+        }
+        page.Data = append(page.Data, c)
+    }
+    if err := rows.Err(); err != nil {
+        dbError(w, err)
+        return
+    }
+    w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+    writeJSON(w, http.StatusOK, shapePage(shape, page, page.Data, pl.meta(limit, offset, page.Total)))
+}
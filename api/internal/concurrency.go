@@ -0,0 +1,52 @@
+package internal
+
+import (
+    "net/http"
+    "time"
+
+    "github.com/gorilla/mux"
+)
+
+// LimitConcurrency caps how many requests to each route in limits, keyed by
+// mux path template like Config.QueryTimeouts, may run at once; routes not
+// listed are unlimited. A request over its route's limit waits up to wait for
+// a slot to free up, then gets a 429 with Retry-After. It keeps a few
+// expensive endpoints, such as the CSV export, from taking the whole DB
+// pool. It sits inside Timeout so a slot is held for as long as the handler
+// runs, and a request's wait counts against its timeout. With no limits it
+// returns next unchanged.
+func LimitConcurrency(next http.Handler, router *mux.Router, limits map[string]int, wait time.Duration) http.Handler {
+    if len(limits) == 0 {
+        return next
+    }
+    slots := make(map[string]chan struct{}, len(limits))
+    for route, n := range limits {
+        slots[route] = make(chan struct{}, n)
+    }
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        route := routeTemplate(router, r)
+        sem, ok := slots[route]
+        if !ok {
+            next.ServeHTTP(w, r)
+            return
+        }
+        select {
+        case sem <- struct{}{}:
+        default:
+            timer := time.NewTimer(wait)
+            defer timer.Stop()
+            select {
+            case sem <- struct{}{}:
+            case <-timer.C:
+                concurrencyRejected.WithLabelValues(route).Inc()
+                w.Header().Set("Retry-After", "1")
+                writeError(w, http.StatusTooManyRequests, CodeRateLimited, "too many concurrent requests to this endpoint; retry shortly")
+                return
+            case <-r.Context().Done():
+                return
+            }
+        }
+        defer func() { <-sem }()
+        next.ServeHTTP(w, r)
+    })
+}
@@ -0,0 +1,526 @@
+package internal
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/url"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/go-sql-driver/mysql"
+)
+
+// Config is the process configuration, read once from the environment by
+// LoadConfig.
+type Config struct {
+    // DBDriver names the database dialect: mysql, or postgres in a build
+    // with -tags postgres.
+    DBDriver string
+
+    DBHost string
+    DBPort string
+    DBName string
+    DBUser string
+    DBPass string
+    // DBReplicaDSN, when set, is a read replica that list and count queries
+    // go to; everything else stays on the primary.
+    DBReplicaDSN string
+
+    DBMaxOpenConns    int
+    DBMaxIdleConns    int
+    DBConnMaxLifetime time.Duration
+
+    DBConnectAttempts  int
+    DBConnectBaseDelay time.Duration
+    RunMigrations      bool
+    // DBTxAttempts is how many times a write transaction is tried when it
+    // hits a deadlock or lock wait timeout.
+    DBTxAttempts int
+    // DBBreakerThreshold failed dials in a row open the circuit breaker for
+    // DBBreakerCooldown.
+    DBBreakerThreshold int
+    DBBreakerCooldown  time.Duration
+
+    Port            string
+    QueryTimeout    time.Duration
+    // QueryTimeouts overrides QueryTimeout per route, keyed by the mux path
+    // template (e.g. /api/customers/{id}). The CSV export defaults to
+    // RequestTimeout.
+    QueryTimeouts   map[string]time.Duration
+    // RouteConcurrency caps the requests in flight per route, keyed like
+    // QueryTimeouts; unlisted routes are unlimited. A request over the cap
+    // waits up to RouteConcurrencyWait for a slot before getting a 429.
+    RouteConcurrency     map[string]int
+    RouteConcurrencyWait time.Duration
+    // SlowQueryThreshold is how long a DB statement may run before it is
+    // logged as slow.
+    SlowQueryThreshold time.Duration
+    // OTLPEndpoint is the OTLP/HTTP collector URL traces are exported to
+    // (e.g. http://otel-collector:4318); empty turns tracing off.
+    OTLPEndpoint string
+    RequestTimeout  time.Duration
+    ShutdownTimeout time.Duration
+    // TLSCertFile and TLSKeyFile, when both set, make the server speak
+    // HTTPS; otherwise it serves plain HTTP.
+    TLSCertFile string
+    TLSKeyFile  string
+
+    CORSAllowedOrigins []string
+    APIKeys            []string
+    // AdminAPIKeys are API keys that may also call /api/admin/*.
+    AdminAPIKeys       []string
+    // JWTSecret (HMAC) and JWTJWKSURL (RSA/ECDSA keys) enable JWT bearer
+    // auth alongside API keys; JWTIssuer and JWTAudience, when set, must
+    // match the token's iss and aud.
+    JWTSecret          string
+    JWTJWKSURL         string
+    JWTIssuer          string
+    JWTAudience        string
+    // APIKeyOrgs places API keys, by fingerprint, in an org; JWTOrgClaim
+    // names the claim carrying a JWT's org. Callers neither assigns go to
+    // the default org.
+    APIKeyOrgs         map[string]int
+    JWTOrgClaim        string
+    // JWTRolesClaim names the claim listing a JWT's roles; a token with
+    // JWTAdminRole among them may call /api/admin/*.
+    JWTRolesClaim      string
+    JWTAdminRole       string
+    LogFormat          string
+    // JSONNulls is "include" (the default) to send unset fields as explicit
+    // nulls or "omit" to leave them out; clients can override it per
+    // request (see NullPolicy).
+    JSONNulls string
+
+    RateLimitRPS   float64
+    RateLimitBurst int
+
+    // PageLimits holds each list resource's page sizes, keyed by the names
+    // in pageResources.
+    PageLimits map[string]PageLimits
+    // CursorSecret keys the signature on pagination cursors. When unset a
+    // random one is made at startup, so cursors then don't survive a restart
+    // or carry over between instances.
+    CursorSecret string
+
+    // StatsCacheTTL is how long a computed /api/stats result is reused.
+    StatsCacheTTL time.Duration
+    // ListCacheMaxAge is the Cache-Control max-age on customer list
+    // responses.
+    ListCacheMaxAge time.Duration
+
+    // WebhookURL, when set, receives a signed POST for each case created or
+    // moved to a new status; WebhookSecret keys the signature and is then
+    // required. A delivery is tried up to WebhookMaxAttempts times.
+    WebhookURL         string
+    WebhookSecret      string
+    WebhookMaxAttempts int
+    // SSEMaxSubscribers caps the open /api/cases/stream connections.
+    SSEMaxSubscribers int
+
+    // MaintenanceMode starts the process with writes disabled; see
+    // Maintenance.
+    MaintenanceMode bool
+
+    // EnablePurge runs the soft-delete purge on this instance; enable it on
+    // one instance only.
+    EnablePurge    bool
+    PurgeInterval  time.Duration
+    PurgeRetention time.Duration
+}
+
+// LoadConfig reads the configuration from the environment. It reports every
+// missing or malformed variable in a single error rather than stopping at the
+// first one.
+func LoadConfig() (*Config, error) {
+    var e envLoader
+    driver := e.str("DB_DRIVER", "mysql")
+    defaultPort := "3306"
+    if driver == "postgres" {
+        defaultPort = "5432"
+    }
+    cfg := &Config{
+        DBDriver: driver,
+        DBHost:   e.str("DB_HOST", "localhost"),
+        DBPort:   e.str("DB_PORT", defaultPort),
+        DBName: e.required("DB_NAME"),
+        DBUser: e.required("DB_USER"),
+        DBPass: e.required("DB_PASS"),
+
+        DBReplicaDSN: os.Getenv("DB_REPLICA_DSN"),
+
+        DBMaxOpenConns:    e.int("DB_MAX_OPEN_CONNS", 10),
+        DBMaxIdleConns:    e.int("DB_MAX_IDLE_CONNS", 5),
+        DBConnMaxLifetime: e.duration("DB_CONN_MAX_LIFETIME", 2*time.Minute),
+
+        DBConnectAttempts:  e.int("DB_CONNECT_ATTEMPTS", 10),
+        DBConnectBaseDelay: e.duration("DB_CONNECT_BASE_DELAY", 500*time.Millisecond),
+        RunMigrations:      e.bool("RUN_MIGRATIONS", false),
+        DBTxAttempts:       e.int("DB_TX_ATTEMPTS", 3),
+        DBBreakerThreshold: e.int("DB_BREAKER_THRESHOLD", 5),
+        DBBreakerCooldown:  e.duration("DB_BREAKER_COOLDOWN", 10*time.Second),
+
+        Port:            e.str("PORT", "8081"),
+        QueryTimeout:    e.duration("DB_QUERY_TIMEOUT", 5*time.Second),
+        QueryTimeouts:   e.durations("DB_QUERY_TIMEOUTS"),
+
+        RouteConcurrency:     e.ints("ROUTE_CONCURRENCY"),
+        RouteConcurrencyWait: e.duration("ROUTE_CONCURRENCY_WAIT", time.Second),
+        SlowQueryThreshold: e.duration("SLOW_QUERY_THRESHOLD", 500*time.Millisecond),
+        OTLPEndpoint:       os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+        RequestTimeout:  e.duration("REQUEST_TIMEOUT", 30*time.Second),
+        ShutdownTimeout: e.duration("SHUTDOWN_TIMEOUT", 15*time.Second),
+        TLSCertFile:     os.Getenv("TLS_CERT_FILE"),
+        TLSKeyFile:      os.Getenv("TLS_KEY_FILE"),
+
+        CORSAllowedOrigins: SplitList(os.Getenv("CORS_ALLOWED_ORIGINS")),
+        APIKeys:            SplitList(os.Getenv("API_KEYS")),
+        AdminAPIKeys:       SplitList(os.Getenv("ADMIN_API_KEYS")),
+        JWTSecret:          os.Getenv("JWT_SECRET"),
+        JWTJWKSURL:         os.Getenv("JWT_JWKS_URL"),
+        JWTIssuer:          os.Getenv("JWT_ISSUER"),
+        JWTAudience:        os.Getenv("JWT_AUDIENCE"),
+        APIKeyOrgs:         e.orgs("API_KEY_ORGS"),
+        JWTOrgClaim:        e.str("JWT_ORG_CLAIM", "org_id"),
+        JWTRolesClaim:      e.str("JWT_ROLES_CLAIM", "roles"),
+        JWTAdminRole:       e.str("JWT_ADMIN_ROLE", "admin"),
+        LogFormat:          e.str("LOG_FORMAT", "text"),
+        JSONNulls:          e.str("JSON_NULLS", nullsInclude),
+
+        RateLimitRPS:   e.float("RATE_LIMIT_RPS", 10),
+        RateLimitBurst: e.int("RATE_LIMIT_BURST", 20),
+
+        CursorSecret: os.Getenv("CURSOR_SECRET"),
+
+        StatsCacheTTL: e.duration("STATS_CACHE_TTL", 30*time.Second),
+        ListCacheMaxAge: e.duration("LIST_CACHE_MAX_AGE", 10*time.Second),
+
+        WebhookURL:         os.Getenv("WEBHOOK_URL"),
+        WebhookSecret:      os.Getenv("WEBHOOK_SECRET"),
+        WebhookMaxAttempts: e.int("WEBHOOK_MAX_ATTEMPTS", 5),
+        SSEMaxSubscribers: e.int("SSE_MAX_SUBSCRIBERS", 100),
+
+        MaintenanceMode: e.bool("MAINTENANCE_MODE", false),
+
+        EnablePurge:    e.bool("ENABLE_PURGE", false),
+        PurgeInterval:  e.duration("PURGE_INTERVAL", time.Hour),
+        PurgeRetention: e.duration("PURGE_RETENTION", 30*24*time.Hour),
+    }
+    // PAGE_SIZE and MAX_PAGE_SIZE apply to every list; <RESOURCE>_PAGE_SIZE
+    // and <RESOURCE>_MAX_PAGE_SIZE (e.g. CASES_MAX_PAGE_SIZE) override them.
+    base := PageLimits{Default: e.int("PAGE_SIZE", defaultPageLimit), Max: e.int("MAX_PAGE_SIZE", maxPageLimit)}
+    cfg.PageLimits = map[string]PageLimits{}
+    for _, res := range pageResources {
+        prefix := strings.ToUpper(res) + "_"
+        pl := PageLimits{Default: e.int(prefix+"PAGE_SIZE", base.Default), Max: e.int(prefix+"MAX_PAGE_SIZE", base.Max)}
+        if pl.Max < pl.Default {
+            e.invalid = append(e.invalid, fmt.Sprintf("%s page size %d exceeds its max %d", res, pl.Default, pl.Max))
+        }
+        cfg.PageLimits[res] = pl
+    }
+    if _, err := lookupDialect(cfg.DBDriver); err != nil {
+        e.invalid = append(e.invalid, err.Error())
+    }
+    if cfg.DBMaxIdleConns > cfg.DBMaxOpenConns {
+        e.invalid = append(e.invalid, fmt.Sprintf("DB_MAX_IDLE_CONNS=%d exceeds DB_MAX_OPEN_CONNS=%d", cfg.DBMaxIdleConns, cfg.DBMaxOpenConns))
+    }
+    // A full export is expected to be slow, so by default it may use the
+    // whole request budget.
+    if _, ok := cfg.QueryTimeouts["/api/customers.csv"]; !ok {
+        cfg.QueryTimeouts["/api/customers.csv"] = cfg.RequestTimeout
+    }
+    for route, d := range cfg.QueryTimeouts {
+        // The request timeout cancels the context too, so a longer query
+        // timeout would never take effect.
+        if d > cfg.RequestTimeout {
+            e.invalid = append(e.invalid, fmt.Sprintf("DB_QUERY_TIMEOUTS %s=%s exceeds REQUEST_TIMEOUT=%s", route, d, cfg.RequestTimeout))
+        }
+    }
+    if cfg.JSONNulls != nullsInclude && cfg.JSONNulls != nullsOmit {
+        e.invalid = append(e.invalid, fmt.Sprintf("JSON_NULLS=%q must be include or omit", cfg.JSONNulls))
+    }
+    if u, err := url.Parse(cfg.OTLPEndpoint); cfg.OTLPEndpoint != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+        e.invalid = append(e.invalid, fmt.Sprintf("OTEL_EXPORTER_OTLP_ENDPOINT=%q must be an http or https URL", cfg.OTLPEndpoint))
+    }
+    if u, err := url.Parse(cfg.WebhookURL); cfg.WebhookURL != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+        e.invalid = append(e.invalid, fmt.Sprintf("WEBHOOK_URL=%q must be an http or https URL", cfg.WebhookURL))
+    }
+    if cfg.WebhookURL != "" && cfg.WebhookSecret == "" {
+        e.invalid = append(e.invalid, "WEBHOOK_SECRET is required when WEBHOOK_URL is set")
+    }
+    if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+        e.invalid = append(e.invalid, "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+    }
+    if err := e.err(); err != nil {
+        return nil, err
+    }
+    if cfg.CursorSecret == "" {
+        key := make([]byte, 32)
+        rand.Read(key)
+        cfg.CursorSecret = hex.EncodeToString(key)
+    }
+    return cfg, nil
+}
+
+// redacted replaces a secret in logged config.
+const redacted = "***"
+
+// LogConfig logs the effective configuration as one structured line, with
+// the DB password, the replica DSN's password, the API and admin API keys
+// and the JWT, webhook and cursor secrets replaced by "***". Under
+// LOG_FORMAT=json the line is a JSON object; otherwise the same object
+// follows a "config: " prefix.
+func LogConfig(cfg *Config) {
+    queryTimeouts := map[string]string{}
+    for route, d := range cfg.QueryTimeouts {
+        queryTimeouts[route] = d.String()
+    }
+    apiKeys := make([]string, len(cfg.APIKeys))
+    for i := range apiKeys {
+        apiKeys[i] = redacted
+    }
+    adminAPIKeys := make([]string, len(cfg.AdminAPIKeys))
+    for i := range adminAPIKeys {
+        adminAPIKeys[i] = redacted
+    }
+    jwtSecret := ""
+    if cfg.JWTSecret != "" {
+        jwtSecret = redacted
+    }
+    webhookSecret := ""
+    if cfg.WebhookSecret != "" {
+        webhookSecret = redacted
+    }
+    summary := map[string]any{
+        "db_driver":              cfg.DBDriver,
+        "db_host":                cfg.DBHost,
+        "db_port":                cfg.DBPort,
+        "db_name":                cfg.DBName,
+        "db_user":                cfg.DBUser,
+        "db_pass":                redacted,
+        "db_replica_dsn":         redactDSN(cfg.DBDriver, cfg.DBReplicaDSN),
+        "db_max_open_conns":      cfg.DBMaxOpenConns,
+        "db_max_idle_conns":      cfg.DBMaxIdleConns,
+        "db_conn_max_lifetime":   cfg.DBConnMaxLifetime.String(),
+        "db_connect_attempts":    cfg.DBConnectAttempts,
+        "db_connect_base_delay":  cfg.DBConnectBaseDelay.String(),
+        "db_tx_attempts":         cfg.DBTxAttempts,
+        "db_breaker_threshold":   cfg.DBBreakerThreshold,
+        "db_breaker_cooldown":    cfg.DBBreakerCooldown.String(),
+        "run_migrations":         cfg.RunMigrations,
+        "port":                   cfg.Port,
+        "tls":                    cfg.TLSCertFile != "",
+        "query_timeout":          cfg.QueryTimeout.String(),
+        "query_timeouts":         queryTimeouts,
+        "route_concurrency":      cfg.RouteConcurrency,
+        "route_concurrency_wait": cfg.RouteConcurrencyWait.String(),
+        "slow_query_threshold":   cfg.SlowQueryThreshold.String(),
+        "otlp_endpoint":          cfg.OTLPEndpoint,
+        "request_timeout":        cfg.RequestTimeout.String(),
+        "shutdown_timeout":       cfg.ShutdownTimeout.String(),
+        "cors_allowed_origins":   cfg.CORSAllowedOrigins,
+        "api_keys":               apiKeys,
+        "admin_api_keys":         adminAPIKeys,
+        "jwt_secret":             jwtSecret,
+        "jwt_jwks_url":           cfg.JWTJWKSURL,
+        "jwt_issuer":             cfg.JWTIssuer,
+        "jwt_audience":           cfg.JWTAudience,
+        "api_key_orgs":           cfg.APIKeyOrgs,
+        "jwt_org_claim":          cfg.JWTOrgClaim,
+        "jwt_roles_claim":        cfg.JWTRolesClaim,
+        "jwt_admin_role":         cfg.JWTAdminRole,
+        "log_format":             cfg.LogFormat,
+        "json_nulls":             cfg.JSONNulls,
+        "rate_limit_rps":         cfg.RateLimitRPS,
+        "rate_limit_burst":       cfg.RateLimitBurst,
+        "page_limits":            cfg.PageLimits,
+        "cursor_secret":          redacted,
+        "stats_cache_ttl":        cfg.StatsCacheTTL.String(),
+        "list_cache_max_age":     cfg.ListCacheMaxAge.String(),
+        "webhook_url":            cfg.WebhookURL,
+        "webhook_secret":         webhookSecret,
+        "webhook_max_attempts":   cfg.WebhookMaxAttempts,
+        "sse_max_subscribers":    cfg.SSEMaxSubscribers,
+        "maintenance_mode":       cfg.MaintenanceMode,
+        "enable_purge":           cfg.EnablePurge,
+        "purge_interval":         cfg.PurgeInterval.String(),
+        "purge_retention":        cfg.PurgeRetention.String(),
+    }
+    if cfg.LogFormat == "json" {
+        line, _ := json.Marshal(map[string]any{"msg": "config", "config": summary})
+        log.Print(string(line))
+        return
+    }
+    line, _ := json.Marshal(summary)
+    log.Print("config: " + string(line))
+}
+
+// redactDSN masks the password in a MySQL DSN. A DSN that doesn't parse,
+// or is for another driver, is masked entirely, since there's no telling
+// where its password is.
+func redactDSN(driver, dsn string) string {
+    if dsn == "" {
+        return ""
+    }
+    if driver != "mysql" {
+        return redacted
+    }
+    mc, err := mysql.ParseDSN(dsn)
+    if err != nil {
+        return redacted
+    }
+    if mc.Passwd != "" {
+        mc.Passwd = redacted
+    }
+    return mc.FormatDSN()
+}
+
+// PageLimits bounds a list's ?limit=: Default when it is absent, and Max as
+// the cap.
+type PageLimits struct {
+    Default int `json:"default"`
+    Max     int `json:"max"`
+}
+
+// pageResources names the paged lists that take PageLimits.
+var pageResources = []string{"customers", "cases", "audit", "attachments", "comments", "timeline"}
+
+// envLoader reads env vars while collecting every problem it finds.
+type envLoader struct {
+    missing []string
+    invalid []string
+}
+
+func (e *envLoader) str(k, def string) string {
+    if v := os.Getenv(k); v != "" {
+        return v
+    }
+    return def
+}
+
+func (e *envLoader) required(k string) string {
+    v := os.Getenv(k)
+    if v == "" {
+        e.missing = append(e.missing, k)
+    }
+    return v
+}
+
+func (e *envLoader) duration(k string, def time.Duration) time.Duration {
+    v := os.Getenv(k)
+    if v == "" {
+        return def
+    }
+    d, err := time.ParseDuration(v)
+    if err != nil || d <= 0 {
+        e.invalid = append(e.invalid, fmt.Sprintf("%s=%q (want a positive duration like 5s)", k, v))
+        return def
+    }
+    return d
+}
+
+// durations reads a comma-separated list of key=duration pairs, such as
+// "/api/customers.csv=30s,/api/customers/{id}=1s".
+func (e *envLoader) durations(k string) map[string]time.Duration {
+    out := map[string]time.Duration{}
+    for _, pair := range SplitList(os.Getenv(k)) {
+        key, v, _ := strings.Cut(pair, "=")
+        d, err := time.ParseDuration(strings.TrimSpace(v))
+        if key = strings.TrimSpace(key); key == "" || err != nil || d <= 0 {
+            e.invalid = append(e.invalid, fmt.Sprintf("%s entry %q (want route=duration, like /api/customers.csv=30s)", k, pair))
+            continue
+        }
+        out[key] = d
+    }
+    return out
+}
+
+// ints reads a comma-separated list of key=count pairs, such as
+// "/api/customers.csv=2".
+func (e *envLoader) ints(k string) map[string]int {
+    out := map[string]int{}
+    for _, pair := range SplitList(os.Getenv(k)) {
+        key, v, _ := strings.Cut(pair, "=")
+        n, err := strconv.Atoi(strings.TrimSpace(v))
+        if key = strings.TrimSpace(key); key == "" || err != nil || n < 1 {
+            e.invalid = append(e.invalid, fmt.Sprintf("%s entry %q (want route=count, like /api/customers.csv=2)", k, pair))
+            continue
+        }
+        out[key] = n
+    }
+    return out
+}
+
+// orgs reads a comma-separated list of fingerprint=org pairs, such as
+// "6ab9f1eb=2,0c1d2e3f=3", where the fingerprint is the one the audit log
+// shows for the key (key:<fingerprint>).
+func (e *envLoader) orgs(k string) map[string]int {
+    out := map[string]int{}
+    for _, pair := range SplitList(os.Getenv(k)) {
+        fp, v, _ := strings.Cut(pair, "=")
+        org, err := strconv.Atoi(strings.TrimSpace(v))
+        if fp = strings.TrimSpace(fp); fp == "" || err != nil || org <= 0 {
+            e.invalid = append(e.invalid, fmt.Sprintf("%s entry %q (want fingerprint=org, like 6ab9f1eb=2)", k, pair))
+            continue
+        }
+        out[fp] = org
+    }
+    return out
+}
+
+func (e *envLoader) int(k string, def int) int {
+    v := os.Getenv(k)
+    if v == "" {
+        return def
+    }
+    n, err := strconv.Atoi(v)
+    if err != nil || n < 1 {
+        e.invalid = append(e.invalid, fmt.Sprintf("%s=%q (want a positive integer)", k, v))
+        return def
+    }
+    return n
+}
+
+func (e *envLoader) float(k string, def float64) float64 {
+    v := os.Getenv(k)
+    if v == "" {
+        return def
+    }
+    f, err := strconv.ParseFloat(v, 64)
+    if err != nil || f <= 0 {
+        e.invalid = append(e.invalid, fmt.Sprintf("%s=%q (want a positive number)", k, v))
+        return def
+    }
+    return f
+}
+
+func (e *envLoader) bool(k string, def bool) bool {
+    v := os.Getenv(k)
+    if v == "" {
+        return def
+    }
+    b, err := strconv.ParseBool(v)
+    if err != nil {
+        e.invalid = append(e.invalid, fmt.Sprintf("%s=%q (want true or false)", k, v))
+        return def
+    }
+    return b
+}
+
+func (e *envLoader) err() error {
+    var parts []string
+    if len(e.missing) > 0 {
+        parts = append(parts, "missing required env vars: "+strings.Join(e.missing, ", "))
+    }
+    if len(e.invalid) > 0 {
+        parts = append(parts, "invalid env vars: "+strings.Join(e.invalid, "; "))
+    }
+    if len(parts) == 0 {
+        return nil
+    }
+    return fmt.Errorf("config: %s", strings.Join(parts, "; "))
+}
@@ -0,0 +1,108 @@
+package internal
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strings"
+    "testing"
+)
+
+// signedPayload is a token for payload carrying a valid signature, to get
+// past the HMAC check to what follows it.
+func signedPayload(payload string) string {
+    return payload + "." + base64.RawURLEncoding.EncodeToString(cursorMAC([]byte(testCursorSecret), payload))
+}
+
+func TestCursorPaging(t *testing.T) {
+    h, _ := newStubHandler(testCustomers(5)...)
+    var pages [][]int
+    for cursor, n := "", 0; n < 5; n++ {
+        rec := httptest.NewRecorder()
+        h.ListCustomers(rec, httptest.NewRequest("GET", "/api/customers?limit=2&cursor="+url.QueryEscape(cursor), nil))
+        if rec.Code != http.StatusOK {
+            t.Fatalf("page %d: status %d: %s", n, rec.Code, rec.Body)
+        }
+        var page struct {
+            Data       []Customer `json:"data"`
+            NextCursor string     `json:"next_cursor"`
+        }
+        if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+            t.Fatal(err)
+        }
+        var ids []int
+        for _, c := range page.Data {
+            ids = append(ids, c.ID)
+        }
+        pages = append(pages, ids)
+        if page.NextCursor == "" {
+            break
+        }
+        cursor = page.NextCursor
+    }
+    if got, want := mustJSON(t, pages), `[[5,4],[3,2],[1]]`; string(got) != want {
+        t.Errorf("pages %s, want %s", got, want)
+    }
+}
+
+func TestCursorRejected(t *testing.T) {
+    valid := encodeCursor([]byte(testCursorSecret), listCursor{ID: 3, Sort: keysetSort})
+    payload, sig, _ := strings.Cut(valid, ".")
+    flip := func(s string, i int) string {
+        b := []byte(s)
+        if b[i] == 'A' {
+            b[i] = 'B'
+        } else {
+            b[i] = 'A'
+        }
+        return string(b)
+    }
+    forged, _ := json.Marshal(listCursor{ID: 1000, Sort: keysetSort})
+
+    for _, tc := range []struct {
+        name, token string
+        err         error
+    }{
+        {"altered signature", payload + "." + flip(sig, 0), errBadCursor},
+        {"altered payload", base64.RawURLEncoding.EncodeToString(forged) + "." + sig, errBadCursor},
+        {"other secret", encodeCursor([]byte("another secret"), listCursor{ID: 3, Sort: keysetSort}), errBadCursor},
+        {"truncated signature", valid[:len(valid)-4], errBadCursor},
+        {"truncated at the dot", payload + ".", errBadCursor},
+        {"payload only", payload, errBadCursor},
+        {"different sort", encodeCursor([]byte(testCursorSecret), listCursor{ID: 3, Sort: "name"}), errCursorSort},
+        {"no sort", signedPayload(base64.RawURLEncoding.EncodeToString([]byte(`{"id":3}`))), errCursorSort},
+        {"bad base64 signature", payload + ".not*base64!", errBadCursor},
+        {"bad base64 payload", signedPayload("not*base64!"), errBadCursor},
+        {"not JSON", signedPayload(base64.RawURLEncoding.EncodeToString([]byte("id=3"))), errBadCursor},
+        {"zero id", encodeCursor([]byte(testCursorSecret), listCursor{ID: 0, Sort: keysetSort}), errBadCursor},
+    } {
+        if _, err := decodeCursor([]byte(testCursorSecret), tc.token, keysetSort); !errors.Is(err, tc.err) {
+            t.Errorf("%s: decodeCursor: got %v, want %v", tc.name, err, tc.err)
+        }
+
+        h, store := newStubHandler(testCustomers(5)...)
+        rec := httptest.NewRecorder()
+        h.ListCustomers(rec, httptest.NewRequest("GET", "/api/customers?cursor="+url.QueryEscape(tc.token), nil))
+        if rec.Code != http.StatusBadRequest {
+            t.Errorf("%s: status %d, want 400", tc.name, rec.Code)
+            continue
+        }
+        var body errorBody
+        if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+            t.Fatal(err)
+        }
+        if body.Error.Code != CodeInvalidParameter || body.Error.Message != tc.err.Error() {
+            t.Errorf("%s: error %q %q, want %q %q", tc.name, body.Error.Code, body.Error.Message, CodeInvalidParameter, tc.err)
+        }
+        if len(store.filters) != 0 {
+            t.Errorf("%s: the store was queried", tc.name)
+        }
+    }
+
+    if _, err := decodeCursor([]byte(testCursorSecret), valid, keysetSort); err != nil {
+        t.Errorf("the untouched token: %v", err)
+    }
+}
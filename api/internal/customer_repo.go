@@ -0,0 +1,608 @@
+package internal
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+    "time"
+)
+
+// Errors returned by CustomerStore; handlers map them to HTTP responses.
+var (
+    ErrNotFound  = errors.New("not found")
+    ErrDuplicate = errors.New("a customer with that email already exists")
+    // ErrIdempotencyInProgress means a concurrent create with the same
+    // Idempotency-Key committed first.
+    ErrIdempotencyInProgress = errors.New("a request with this Idempotency-Key is already being processed")
+    // ErrModified means the customer changed after the time a conditional
+    // write required it to be unchanged since.
+    ErrModified = errors.New("the customer was modified after the given time")
+    // ErrMergeDeleted means one side of a Merge is soft-deleted.
+    ErrMergeDeleted = errors.New("cannot merge a deleted customer")
+)
+
+// ConflictError is returned by a versioned write when the row has moved past
+// the version the caller read. Current is the row as it is now.
+type ConflictError struct {
+    Current Customer
+}
+
+func (e *ConflictError) Error() string {
+    return "customer was modified by someone else; re-apply your changes to the current version"
+}
+
+// RowError reports which row of a BulkCreate failed.
+type RowError struct {
+    Index int
+    Err   error
+}
+
+func (e *RowError) Error() string { return fmt.Sprintf("row %d: %v", e.Index, e.Err) }
+func (e *RowError) Unwrap() error { return e.Err }
+
+// CustomerFilter selects customers for List, Each and Count. The zero value
+// matches every live customer, newest first, with no limit.
+type CustomerFilter struct {
+    Query          string // case-insensitive substring of name, email or phone
+    IncludeDeleted bool
+    CreatedAfter   *time.Time // created_at >= CreatedAfter
+    CreatedBefore  *time.Time // created_at < CreatedBefore
+    Sort           string     // a customerSortColumns key, "-" prefix for descending; "" means -id
+    IDs            []int      // when set, only these ids
+
+    // Paging; Count ignores these. BeforeID > 0 keeps only ids below it,
+    // for keyset pagination.
+    BeforeID int
+    Limit    int
+    Offset   int
+}
+
+// CustomerChanges is the set of fields an Update writes; a nil Name and a
+// false SetEmail or SetPhone leave those columns as they are.
+type CustomerChanges struct {
+    Name     *string
+    SetEmail bool
+    Email    *string // nil stores NULL
+    SetPhone bool
+    Phone    *string // nil stores NULL
+}
+
+// IdempotencyKey ties a Create to a client's Idempotency-Key header. Hash is
+// the hash of the request body the key was sent with.
+type IdempotencyKey struct {
+    Key  string
+    Hash string
+}
+
+// CustomerStore is the customer persistence the handlers depend on. Writes
+// take the caller's identity for the audit log from ctx.
+type CustomerStore interface {
+    List(ctx context.Context, f CustomerFilter) ([]Customer, error)
+    // Each calls fn for every customer f matches, as rows are read.
+    Each(ctx context.Context, f CustomerFilter, fn func(Customer) error) error
+    Count(ctx context.Context, f CustomerFilter) (int, error)
+    Get(ctx context.Context, id int) (Customer, error)
+    Create(ctx context.Context, in CustomerInput, idem *IdempotencyKey) (Customer, error)
+    BulkCreate(ctx context.Context, in []CustomerInput) ([]Customer, error)
+    Update(ctx context.Context, id, version int, ch CustomerChanges) (Customer, error)
+    // Delete is unconditional when unmodifiedSince is zero.
+    Delete(ctx context.Context, id int, unmodifiedSince time.Time) error
+    Restore(ctx context.Context, id int) (Customer, error)
+    // Merge folds sourceID into targetID and returns the updated target.
+    Merge(ctx context.Context, targetID, sourceID int) (Customer, error)
+    // Replay returns the stored response for a key seen within the
+    // idempotency window, ErrNotFound if there is none, or
+    // ErrIdempotencyMismatch if the key came with a different body.
+    Replay(ctx context.Context, idem IdempotencyKey) (status int, body []byte, err error)
+}
+
+// CustomerRepo is the MySQL CustomerStore. Each write runs in one
+// transaction, tried up to txAttempts times on deadlock (see withRetry).
+// Every query is scoped to the caller's org (orgFromContext): other orgs'
+// customers read as not found, and new ones are stamped with the org.
+type CustomerRepo struct {
+    db         *sql.DB
+    // reader serves List, Each and Count; it is db when there's no replica.
+    reader     *sql.DB
+    txAttempts int
+
+    // Statements for the hottest reads, prepared once: fetching by id and
+    // the unfiltered, default-ordered list page and its count.
+    getStmt   *sql.Stmt
+    listStmt  *sql.Stmt
+    countStmt *sql.Stmt
+}
+
+// NewCustomerRepo prepares the repo's statements, so the customers table must
+// already exist. Close releases them. Lists and counts read from reader,
+// which may be a replica or nil for db; Get stays on db so a client reads
+// its own writes.
+func NewCustomerRepo(ctx context.Context, db, reader *sql.DB, txAttempts int) (*CustomerRepo, error) {
+    if reader == nil {
+        reader = db
+    }
+    r := &CustomerRepo{db: db, reader: reader, txAttempts: txAttempts}
+    for _, p := range []struct {
+        db    *sql.DB
+        dst   **sql.Stmt
+        query string
+    }{
+        {db, &r.getStmt, `SELECT ` + customerColumns + ` FROM customers WHERE org_id = ? AND id = ? AND deleted_at IS NULL`},
+        {reader, &r.listStmt, `SELECT ` + customerColumns + ` FROM customers WHERE org_id = ? AND deleted_at IS NULL ORDER BY id DESC LIMIT ? OFFSET ?`},
+        {reader, &r.countStmt, `SELECT COUNT(*) FROM customers WHERE org_id = ? AND deleted_at IS NULL`},
+    } {
+        stmt, err := p.db.PrepareContext(ctx, p.query)
+        if err != nil {
+            r.Close()
+            return nil, fmt.Errorf("prepare customer queries: %w", err)
+        }
+        *p.dst = stmt
+    }
+    return r, nil
+}
+
+// Close closes the prepared statements.
+func (r *CustomerRepo) Close() error {
+    var errs []error
+    for _, stmt := range []*sql.Stmt{r.getStmt, r.listStmt, r.countStmt} {
+        if stmt != nil {
+            errs = append(errs, stmt.Close())
+        }
+    }
+    return errors.Join(errs...)
+}
+
+// unfiltered reports whether f selects every live customer, as countStmt
+// counts them.
+func unfiltered(f CustomerFilter) bool {
+    return strings.TrimSpace(f.Query) == "" && !f.IncludeDeleted && f.CreatedAfter == nil && f.CreatedBefore == nil && len(f.IDs) == 0
+}
+
+// isDefaultList reports whether f is the plain list page listStmt covers:
+// unfiltered, newest first, offset-paged.
+func isDefaultList(f CustomerFilter) bool {
+    return unfiltered(f) && (f.Sort == "" || f.Sort == "-id") && f.BeforeID == 0 && f.Limit > 0
+}
+
+// customerColumns is the select list matching scanCustomer.
+const customerColumns = "id, name, email, phone, version, created_at, updated_at, deleted_at"
+
+type rowScanner interface {
+    Scan(dest ...any) error
+}
+
+func scanCustomer(row rowScanner) (Customer, error) {
+    var c Customer
+    err := row.Scan(&c.ID, &c.Name, &c.Email, &c.Phone, &c.Version, &c.CreatedAt, &c.UpdatedAt, &c.DeletedAt)
+    return c, err
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+    ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+    QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+    QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// customerWhere builds the WHERE clause (with a leading space) and its bound
+// arguments from the caller's org and f's filter fields, so the row queries
+// and COUNT(*) can't drift apart.
+func customerWhere(ctx context.Context, f CustomerFilter) (string, []any) {
+    preds := []string{"org_id = ?"}
+    args := []any{orgFromContext(ctx)}
+    if !f.IncludeDeleted {
+        preds = append(preds, "deleted_at IS NULL")
+    }
+    if term := strings.ToLower(strings.TrimSpace(f.Query)); term != "" {
+        like := "%" + likeEscaper.Replace(term) + "%"
+        if digits := phoneSearchTerm(term); digits != "" {
+            preds = append(preds, "(name "+dialect.like()+" ? OR email "+dialect.like()+" ? OR phone LIKE ?)")
+            args = append(args, like, like, "%"+digits+"%")
+        } else {
+            preds = append(preds, "(name "+dialect.like()+" ? OR email "+dialect.like()+" ?)")
+            args = append(args, like, like)
+        }
+    }
+    if len(f.IDs) > 0 {
+        preds = append(preds, "id IN (?"+strings.Repeat(", ?", len(f.IDs)-1)+")")
+        for _, id := range f.IDs {
+            args = append(args, id)
+        }
+    }
+    if f.CreatedAfter != nil {
+        preds = append(preds, "created_at >= ?")
+        args = append(args, *f.CreatedAfter)
+    }
+    if f.CreatedBefore != nil {
+        preds = append(preds, "created_at < ?")
+        args = append(args, *f.CreatedBefore)
+    }
+    return " WHERE " + strings.Join(preds, " AND "), args
+}
+
+// andWhere adds pred to a clause built by customerWhere.
+func andWhere(where, pred string) string {
+    if where == "" {
+        return " WHERE " + pred
+    }
+    return where + " AND " + pred
+}
+
+// customerSortColumns maps the accepted sort fields to their columns.
+// Column names can't be bound as parameters, so only these are ever
+// interpolated into the ORDER BY clause.
+var customerSortColumns = map[string]string{
+    "id":         "id",
+    "name":       "name",
+    "created_at": "created_at",
+}
+
+// errBadSort is returned for a sort field outside customerSortColumns.
+var errBadSort = errors.New("sort must be one of id, name, created_at, optionally prefixed with -")
+
+// customerOrder builds the ORDER BY clause (with a leading space) for a
+// CustomerFilter.Sort value.
+func customerOrder(sort string) (string, error) {
+    if sort == "" {
+        sort = "-id"
+    }
+    dir := "ASC"
+    if strings.HasPrefix(sort, "-") {
+        sort, dir = sort[1:], "DESC"
+    }
+    col, ok := customerSortColumns[sort]
+    if !ok {
+        return "", errBadSort
+    }
+    if col == "id" {
+        return " ORDER BY id " + dir, nil
+    }
+    // Tie-break on id so pages are stable when the sort column has duplicates.
+    return " ORDER BY " + col + " " + dir + ", id " + dir, nil
+}
+
+// phoneSearchTerm returns the digits of a ?q= that looks like part of a
+// phone number (at least three digits once separators and a leading "+" are
+// dropped), or "" for one that doesn't.
+func phoneSearchTerm(term string) string {
+    digits := strings.TrimPrefix(phoneSeparators.Replace(term), "+")
+    if len(digits) < 3 || strings.Trim(digits, "0123456789") != "" {
+        return ""
+    }
+    return digits
+}
+
+// likeEscaper escapes LIKE wildcards so user input only matches literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// query runs the SELECT for f, paging included.
+func (r *CustomerRepo) query(ctx context.Context, f CustomerFilter) (*sql.Rows, error) {
+    if isDefaultList(f) {
+        return r.listStmt.QueryContext(ctx, orgFromContext(ctx), f.Limit, f.Offset)
+    }
+    order, err := customerOrder(f.Sort)
+    if err != nil {
+        return nil, err
+    }
+    where, args := customerWhere(ctx, f)
+    if f.BeforeID > 0 {
+        where, args = andWhere(where, "id < ?"), append(args, f.BeforeID)
+    }
+    page := ""
+    if f.Limit > 0 {
+        page, args = " LIMIT ? OFFSET ?", append(args, f.Limit, f.Offset)
+    }
+    return r.reader.QueryContext(ctx, `SELECT `+customerColumns+` FROM customers`+where+order+page, args...)
+}
+
+func (r *CustomerRepo) List(ctx context.Context, f CustomerFilter) ([]Customer, error) {
+    out := []Customer{}
+    err := r.Each(ctx, f, func(c Customer) error {
+        out = append(out, c)
+        return nil
+    })
+    return out, err
+}
+
+func (r *CustomerRepo) Each(ctx context.Context, f CustomerFilter, fn func(Customer) error) error {
+    rows, err := r.query(ctx, f)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        c, err := scanCustomer(rows)
+        if err != nil {
+            return err
+        }
+        if err := fn(c); err != nil {
+            return err
+        }
+    }
+    // rows.Next also returns false when the result set is cut short, so
+    // check before reporting a possibly truncated list as complete.
+    return rows.Err()
+}
+
+func (r *CustomerRepo) Count(ctx context.Context, f CustomerFilter) (int, error) {
+    var n int
+    if unfiltered(f) {
+        err := r.countStmt.QueryRowContext(ctx, orgFromContext(ctx)).Scan(&n)
+        return n, err
+    }
+    where, args := customerWhere(ctx, f)
+    err := r.reader.QueryRowContext(ctx, `SELECT COUNT(*) FROM customers`+where, args...).Scan(&n)
+    return n, err
+}
+
+// Get loads a customer that hasn't been soft-deleted.
+func (r *CustomerRepo) Get(ctx context.Context, id int) (Customer, error) {
+    return notFound(scanCustomer(r.getStmt.QueryRowContext(ctx, orgFromContext(ctx), id)))
+}
+
+func loadCustomer(ctx context.Context, q querier, id int) (Customer, error) {
+    row := q.QueryRowContext(ctx, `SELECT `+customerColumns+` FROM customers WHERE org_id = ? AND id = ? AND deleted_at IS NULL`,
+        orgFromContext(ctx), id)
+    return notFound(scanCustomer(row))
+}
+
+// lockCustomer loads a customer with a row lock held until tx ends. deleted
+// selects whether a soft-deleted or a live row is wanted.
+func lockCustomer(ctx context.Context, tx *sql.Tx, id int, deleted bool) (Customer, error) {
+    cond := "deleted_at IS NULL"
+    if deleted {
+        cond = "deleted_at IS NOT NULL"
+    }
+    row := tx.QueryRowContext(ctx, `SELECT `+customerColumns+` FROM customers WHERE org_id = ? AND id = ? AND `+cond+` FOR UPDATE`,
+        orgFromContext(ctx), id)
+    return notFound(scanCustomer(row))
+}
+
+// notFound translates sql.ErrNoRows to ErrNotFound.
+func notFound(c Customer, err error) (Customer, error) {
+    if errors.Is(err, sql.ErrNoRows) {
+        err = ErrNotFound
+    }
+    return c, err
+}
+
+// Create inserts a customer. With idem set, the created customer is stored
+// as the response to replay for that key, in the same transaction.
+func (r *CustomerRepo) Create(ctx context.Context, in CustomerInput, idem *IdempotencyKey) (Customer, error) {
+    var c Customer
+    err := r.WithTx(ctx, func(tx *sql.Tx) error {
+        var err error
+        if c, err = insertCustomer(ctx, tx, in); err != nil {
+            return err
+        }
+        if idem == nil {
+            return nil
+        }
+        resp, _ := json.Marshal(c)
+        err = saveIdempotent(ctx, tx, idem.Key, idem.Hash, http.StatusCreated, resp)
+        if isDuplicateKey(err) {
+            return ErrIdempotencyInProgress
+        }
+        return err
+    })
+    return c, err
+}
+
+// BulkCreate inserts all of in in one transaction, rolling back on the first
+// failure, which is returned as a *RowError.
+func (r *CustomerRepo) BulkCreate(ctx context.Context, in []CustomerInput) ([]Customer, error) {
+    var out []Customer
+    err := r.WithTx(ctx, func(tx *sql.Tx) error {
+        out = make([]Customer, 0, len(in))
+        for i, c := range in {
+            created, err := insertCustomer(ctx, tx, c)
+            if err != nil {
+                return &RowError{Index: i, Err: err}
+            }
+            out = append(out, created)
+        }
+        return nil
+    })
+    return out, err
+}
+
+// insertCustomer inserts and audits one customer inside tx.
+func insertCustomer(ctx context.Context, tx *sql.Tx, in CustomerInput) (Customer, error) {
+    id, err := insertID(ctx, tx, `INSERT INTO customers (org_id, name, email, phone, created_at) VALUES (?, ?, ?, ?, NOW())`,
+        orgFromContext(ctx), in.Name, in.Email, in.Phone)
+    if err != nil {
+        if isDuplicateKey(err) {
+            return Customer{}, ErrDuplicate
+        }
+        return Customer{}, err
+    }
+    c, err := loadCustomer(ctx, tx, int(id))
+    if err != nil {
+        return Customer{}, err
+    }
+    return c, recordAudit(ctx, tx, "create", "customer", c.ID, nil, c)
+}
+
+// Update applies ch to a live customer if it is still at version, bumping
+// the version. A stale version gets a *ConflictError and writes nothing.
+func (r *CustomerRepo) Update(ctx context.Context, id, version int, ch CustomerChanges) (Customer, error) {
+    var sets []string
+    var args []any
+    if ch.Name != nil {
+        sets = append(sets, "name = ?")
+        args = append(args, *ch.Name)
+    }
+    if ch.SetEmail {
+        sets = append(sets, "email = ?")
+        args = append(args, ch.Email)
+    }
+    if ch.SetPhone {
+        sets = append(sets, "phone = ?")
+        args = append(args, ch.Phone)
+    }
+    sets = append(sets, "version = version + 1")
+
+    var after Customer
+    err := r.WithTx(ctx, func(tx *sql.Tx) error {
+        before, err := lockCustomer(ctx, tx, id, false)
+        if err != nil {
+            return err
+        }
+        if before.Version != version {
+            return &ConflictError{Current: before}
+        }
+        if _, err := tx.ExecContext(ctx, `UPDATE customers SET `+strings.Join(sets, ", ")+` WHERE id = ?`,
+            append(args, id)...); err != nil {
+            if isDuplicateKey(err) {
+                return ErrDuplicate
+            }
+            return err
+        }
+        after, err = finishWrite(ctx, tx, "update", before)
+        return err
+    })
+    return after, err
+}
+
+// Delete soft-deletes a live customer by stamping deleted_at. With a
+// non-zero unmodifiedSince, a customer updated after it is left alone and
+// ErrModified returned.
+func (r *CustomerRepo) Delete(ctx context.Context, id int, unmodifiedSince time.Time) error {
+    _, err := r.setDeleted(ctx, id, true, unmodifiedSince)
+    return err
+}
+
+// Restore clears deleted_at on a soft-deleted customer; ErrNotFound means
+// there is no deleted customer with that id.
+func (r *CustomerRepo) Restore(ctx context.Context, id int) (Customer, error) {
+    return r.setDeleted(ctx, id, false, time.Time{})
+}
+
+// Merge moves the source customer's cases to the target, fills the target's
+// empty fields from the source, and soft-deletes the source, all in one
+// transaction. Both must be live: a soft-deleted one gets ErrMergeDeleted,
+// a missing one ErrNotFound.
+func (r *CustomerRepo) Merge(ctx context.Context, targetID, sourceID int) (Customer, error) {
+    var after Customer
+    err := r.WithTx(ctx, func(tx *sql.Tx) error {
+        // Lock in id order so two merges of the same pair can't deadlock.
+        ids := []int{targetID, sourceID}
+        if sourceID < targetID {
+            ids[0], ids[1] = sourceID, targetID
+        }
+        locked := map[int]Customer{}
+        for _, id := range ids {
+            c, err := lockMergeable(ctx, tx, id)
+            if err != nil {
+                return err
+            }
+            locked[id] = c
+        }
+        target, source := locked[targetID], locked[sourceID]
+
+        if _, err := tx.ExecContext(ctx, `UPDATE cases SET customer_id = ? WHERE customer_id = ?`, targetID, sourceID); err != nil {
+            return err
+        }
+        // Emails are unique even among deleted rows, so the source gives
+        // its email up before the target takes it.
+        moveEmail := target.Email == nil && source.Email != nil
+        del := `UPDATE customers SET deleted_at = NOW() WHERE id = ?`
+        if moveEmail {
+            del = `UPDATE customers SET deleted_at = NOW(), email = NULL WHERE id = ?`
+        }
+        if _, err := tx.ExecContext(ctx, del, sourceID); err != nil {
+            return err
+        }
+        if _, err := finishWrite(ctx, tx, "delete", source); err != nil {
+            return err
+        }
+        // The target's version moves even with no field copied, since its
+        // cases changed.
+        email := target.Email
+        if moveEmail {
+            email = source.Email
+        }
+        phone := target.Phone
+        if phone == nil {
+            phone = source.Phone
+        }
+        if _, err := tx.ExecContext(ctx, `UPDATE customers SET email = ?, phone = ?, version = version + 1 WHERE id = ?`, email, phone, targetID); err != nil {
+            return err
+        }
+        var err error
+        after, err = finishWrite(ctx, tx, "merge", target)
+        return err
+    })
+    return after, err
+}
+
+// lockMergeable locks a live customer for Merge, telling a soft-deleted one
+// (ErrMergeDeleted) apart from one that doesn't exist (ErrNotFound).
+func lockMergeable(ctx context.Context, tx *sql.Tx, id int) (Customer, error) {
+    c, err := lockCustomer(ctx, tx, id, false)
+    if !errors.Is(err, ErrNotFound) {
+        return c, err
+    }
+    if _, err := lockCustomer(ctx, tx, id, true); err != nil {
+        return Customer{}, err
+    }
+    return Customer{}, ErrMergeDeleted
+}
+
+func (r *CustomerRepo) setDeleted(ctx context.Context, id int, deleted bool, unmodifiedSince time.Time) (Customer, error) {
+    action, stamp := "delete", "NOW()"
+    if !deleted {
+        action, stamp = "restore", "NULL"
+    }
+    var after Customer
+    err := r.WithTx(ctx, func(tx *sql.Tx) error {
+        before, err := lockCustomer(ctx, tx, id, !deleted)
+        if err != nil {
+            return err
+        }
+        // HTTP dates have whole seconds, so compare at that precision.
+        if !unmodifiedSince.IsZero() && before.UpdatedAt != nil && before.UpdatedAt.Truncate(time.Second).After(unmodifiedSince) {
+            return ErrModified
+        }
+        if _, err := tx.ExecContext(ctx, `UPDATE customers SET deleted_at = `+stamp+` WHERE id = ?`, id); err != nil {
+            return err
+        }
+        after, err = finishWrite(ctx, tx, action, before)
+        return err
+    })
+    return after, err
+}
+
+// finishWrite re-reads the customer changed in tx and audits the change
+// against before.
+func finishWrite(ctx context.Context, tx *sql.Tx, action string, before Customer) (Customer, error) {
+    after, err := lockCustomer(ctx, tx, before.ID, action == "delete")
+    if err != nil {
+        return Customer{}, err
+    }
+    return after, recordAudit(ctx, tx, action, "customer", before.ID, before, after)
+}
+
+func (r *CustomerRepo) Replay(ctx context.Context, idem IdempotencyKey) (int, []byte, error) {
+    var storedHash string
+    var status int
+    var body []byte
+    err := r.db.QueryRowContext(ctx, `SELECT request_hash, status_code, response_body FROM idempotency_keys
+        WHERE org_id = ? AND idem_key = ? AND created_at > `+dialect.secondsAgo(), orgFromContext(ctx), idem.Key, idempotencyWindow).
+        Scan(&storedHash, &status, &body)
+    if errors.Is(err, sql.ErrNoRows) {
+        return 0, nil, ErrNotFound
+    }
+    if err != nil {
+        return 0, nil, err
+    }
+    if storedHash != idem.Hash {
+        return 0, nil, ErrIdempotencyMismatch
+    }
+    return status, body, nil
+}
@@ -1,27 +1,124 @@
 package internal
 
 import (
+    "context"
     "database/sql"
+    "database/sql/driver"
     "fmt"
-    "os"
+    "log"
+    "net"
+    "time"
+
+    "github.com/go-sql-driver/mysql"
 )
 
-func OpenDB() (*sql.DB, error) {
-    host := getenv("DB_HOST", "localhost")
-    port := getenv("DB_PORT", "3306")
-    name := getenv("DB_NAME", "appdb")
-    user := getenv("DB_USER", "appuser")
-    pass := getenv("DB_PASS", "changeme_app")
+// OpenDB opens the primary, dialing through brk. It first selects the
+// dialect named by Config.DBDriver, which every query then goes through, so
+// it must run before anything touches the database.
+func OpenDB(cfg *Config, brk *Breaker) (*sql.DB, error) {
+    d, err := lookupDialect(cfg.DBDriver)
+    if err != nil {
+        return nil, err
+    }
+    dialect = d
+    conn, err := dialect.connector(cfg, "")
+    if err != nil {
+        return nil, err
+    }
+    return openPool(conn, cfg, brk), nil
+}
+
+// OpenReplica opens the read replica named by Config.DBReplicaDSN, or
+// returns nil when none is configured. The DSN gets the same driver options
+// as the primary's, so rows scan identically from either database. It
+// dials through brk, which should not be the primary's.
+func OpenReplica(cfg *Config, brk *Breaker) (*sql.DB, error) {
+    if cfg.DBReplicaDSN == "" {
+        return nil, nil
+    }
+    conn, err := dialect.connector(cfg, cfg.DBReplicaDSN)
+    if err != nil {
+        return nil, fmt.Errorf("DB_REPLICA_DSN: %w", err)
+    }
+    return openPool(conn, cfg, brk), nil
+}
+
+// openPool opens a pool that dials through brk (see Breaker) and whose
+// statements are logged when slower than Config.SlowQueryThreshold, traced
+// when tracing is on, and rebound for a positional dialect (see
+// observedConnector).
+func openPool(conn driver.Connector, cfg *Config, brk *Breaker) *sql.DB {
+    conn = breakerConnector{Connector: conn, b: brk}
+    obs := queryObserver{system: dialect.Name(), slow: cfg.SlowQueryThreshold, tracer: tracer, positional: dialect.positional()}
+    if obs.slow > 0 || obs.tracer != nil || obs.positional {
+        conn = observedConnector{Connector: conn, obs: obs}
+    }
+    return sql.OpenDB(conn)
+}
 
-    dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true&charset=utf8mb4,utf8",
-        user, pass, host, port, name)
+// buildConfig assembles the driver config field by field rather than as a
+// DSN string, so credentials containing reserved characters like '@', ':'
+// or '/' are handled correctly.
+func buildConfig(host, port, name, user, pass string) *mysql.Config {
+    cfg := mysql.NewConfig()
+    cfg.User = user
+    cfg.Passwd = pass
+    cfg.Net = "tcp"
+    cfg.Addr = net.JoinHostPort(host, port)
+    cfg.DBName = name
+    setDriverOptions(cfg)
+    return cfg
+}
 
-    return sql.Open("mysql", dsn)
+// setDriverOptions sets the MySQL connection options the repo code relies
+// on.
+func setDriverOptions(cfg *mysql.Config) {
+    // Timestamps are stored and read in UTC: the session time_zone makes
+    // TIMESTAMP columns come back as UTC whatever the server's zone is, and
+    // Loc makes the driver parse them (and send time arguments) as UTC, so
+    // they serialize as RFC3339 with a Z suffix.
+    cfg.ParseTime = true
+    cfg.Loc = time.UTC
+    // clientFoundRows makes RowsAffected count matched rows, so an UPDATE that
+    // leaves a row unchanged isn't mistaken for a missing row.
+    cfg.ClientFoundRows = true
+    if cfg.Params == nil {
+        cfg.Params = map[string]string{}
+    }
+    if _, ok := cfg.Params["charset"]; !ok {
+        cfg.Params["charset"] = "utf8mb4,utf8"
+    }
+    cfg.Params["time_zone"] = "'+00:00'"
 }
 
-func getenv(k, def string) string {
-    if v := os.Getenv(k); v != "" {
-        return v
+// maxConnectDelay caps the backoff between WaitForDB attempts.
+const maxConnectDelay = 30 * time.Second
+
+// WaitForDB pings db until it answers, up to attempts times, doubling the
+// delay after each failure starting from baseDelay. It exists because sql.Open
+// is lazy: without it an API that boots alongside its database would accept
+// traffic before the database is ready.
+func WaitForDB(ctx context.Context, db *sql.DB, attempts int, baseDelay time.Duration) error {
+    delay := baseDelay
+    var err error
+    for i := 1; i <= attempts; i++ {
+        pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+        err = db.PingContext(pingCtx)
+        cancel()
+        if err == nil {
+            log.Printf("db: connected on attempt %d/%d", i, attempts)
+            return nil
+        }
+        if i == attempts {
+            break
+        }
+        log.Printf("db: attempt %d/%d failed: %v; retrying in %s", i, attempts, err, delay)
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-time.After(delay):
+        }
+        delay = min(delay*2, maxConnectDelay)
     }
-    return def
-}
\ No newline at end of file
+    return fmt.Errorf("db: unreachable after %d attempts: %w", attempts, err)
+}
@@ -0,0 +1,163 @@
+package internal
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "net/http/httptest"
+    "os"
+    "testing"
+    "time"
+
+    "github.com/go-sql-driver/mysql"
+)
+
+func TestBuildConfigReservedCharacters(t *testing.T) {
+    for _, pass := range []string{
+        "p@ss:w/rd?#%",
+        "with spaces in it",
+        "@:/?#% all together ",
+        "%40 already escaped",
+        "",
+    } {
+        cfg := buildConfig("db.internal", "3306", "caseinv", "api", pass)
+        dsn := cfg.FormatDSN()
+        parsed, err := mysql.ParseDSN(dsn)
+        if err != nil {
+            t.Errorf("password %q: ParseDSN(FormatDSN()): %v", pass, err)
+            continue
+        }
+        if parsed.Passwd != pass {
+            t.Errorf("password %q came back as %q", pass, parsed.Passwd)
+        }
+        if parsed.User != "api" || parsed.Addr != "db.internal:3306" || parsed.DBName != "caseinv" {
+            t.Errorf("password %q: got user %q, addr %q, db %q", pass, parsed.User, parsed.Addr, parsed.DBName)
+        }
+    }
+}
+
+// unreachableDB is a pool for a server nothing listens on (port 1), so any
+// call that gets as far as dialing fails.
+func unreachableDB(t *testing.T) *sql.DB {
+    t.Helper()
+    conn, err := mysql.NewConnector(buildConfig("127.0.0.1", "1", "caseinv", "api", "x"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    db := sql.OpenDB(conn)
+    t.Cleanup(func() { db.Close() })
+    return db
+}
+
+func TestWaitForDBCancelled(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    start := time.Now()
+    err := WaitForDB(ctx, unreachableDB(t), 5, 10*time.Second)
+    if !errors.Is(err, context.Canceled) {
+        t.Errorf("got %v, want context.Canceled", err)
+    }
+    if d := time.Since(start); d > time.Second {
+        t.Errorf("returned after %s", d)
+    }
+}
+
+func TestDBContextCancelled(t *testing.T) {
+    h := &Handler{Config: &Config{QueryTimeout: time.Minute}}
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    r := httptest.NewRequest("GET", "/api/customers", nil).WithContext(ctx)
+
+    dbCtx, dbCancel := h.dbContext(r)
+    defer dbCancel()
+    select {
+    case <-dbCtx.Done():
+    default:
+        t.Fatal("db context of a cancelled request isn't done")
+    }
+    if !errors.Is(dbCtx.Err(), context.Canceled) {
+        t.Errorf("got %v, want context.Canceled", dbCtx.Err())
+    }
+    if deadline, ok := dbCtx.Deadline(); !ok || time.Until(deadline) > time.Minute {
+        t.Errorf("deadline %v, want within QueryTimeout", deadline)
+    }
+
+    start := time.Now()
+    var one int
+    err := unreachableDB(t).QueryRowContext(dbCtx, "SELECT 1").Scan(&one)
+    if !errors.Is(err, context.Canceled) {
+        t.Errorf("query: got %v, want context.Canceled", err)
+    }
+    if d := time.Since(start); d > time.Second {
+        t.Errorf("query returned after %s", d)
+    }
+}
+
+func TestDriverOptionsUTC(t *testing.T) {
+    primary := buildConfig("db.internal", "3306", "caseinv", "api", "x")
+    // A replica DSN asking for another zone still gets UTC.
+    replica, err := mysql.ParseDSN("api:x@tcp(replica:3306)/caseinv?loc=Local&time_zone=%27SYSTEM%27")
+    if err != nil {
+        t.Fatal(err)
+    }
+    setDriverOptions(replica)
+
+    for name, cfg := range map[string]*mysql.Config{"primary": primary, "replica": replica} {
+        // What the connector is built from is the parsed form of the DSN.
+        parsed, err := mysql.ParseDSN(cfg.FormatDSN())
+        if err != nil {
+            t.Fatalf("%s: %v", name, err)
+        }
+        if !parsed.ParseTime || parsed.Loc != time.UTC {
+            t.Errorf("%s: ParseTime %v, Loc %v; want true, UTC", name, parsed.ParseTime, parsed.Loc)
+        }
+        if tz := parsed.Params["time_zone"]; tz != "'+00:00'" {
+            t.Errorf("%s: time_zone %q, want '+00:00'", name, tz)
+        }
+    }
+}
+
+// TestTimestampRoundTripUTC needs a MySQL or MariaDB server, named by
+// TEST_MYSQL_DSN (e.g. "api:secret@tcp(localhost:3306)/caseinv").
+func TestTimestampRoundTripUTC(t *testing.T) {
+    dsn := os.Getenv("TEST_MYSQL_DSN")
+    if dsn == "" {
+        t.Skip("TEST_MYSQL_DSN not set")
+    }
+    conn, err := mysqlDialect{}.connector(&Config{}, dsn)
+    if err != nil {
+        t.Fatal(err)
+    }
+    db := sql.OpenDB(conn)
+    defer db.Close()
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+    if _, err := db.ExecContext(ctx, "CREATE TABLE utc_round_trip (ts TIMESTAMP NULL, dt DATETIME NULL)"); err != nil {
+        t.Fatal(err)
+    }
+    defer db.Exec("DROP TABLE utc_round_trip")
+
+    tokyo := time.FixedZone("JST", 9*60*60)
+    at := time.Date(2026, 3, 1, 21, 30, 15, 0, tokyo)
+    if _, err := db.ExecContext(ctx, "INSERT INTO utc_round_trip (ts, dt) VALUES (?, ?)", at, at); err != nil {
+        t.Fatal(err)
+    }
+
+    var ts, dt time.Time
+    var text string
+    err = db.QueryRowContext(ctx, "SELECT ts, dt, DATE_FORMAT(ts, '%Y-%m-%d %H:%i:%s') FROM utc_round_trip").Scan(&ts, &dt, &text)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for name, got := range map[string]time.Time{"TIMESTAMP": ts, "DATETIME": dt} {
+        if !got.Equal(at) || got.Location() != time.UTC {
+            t.Errorf("%s read back as %v, want %v in UTC", name, got, at.UTC())
+        }
+        if got.Format(time.RFC3339) != "2026-03-01T12:30:15Z" {
+            t.Errorf("%s serializes as %s", name, got.Format(time.RFC3339))
+        }
+    }
+    if text != "2026-03-01 12:30:15" {
+        t.Errorf("the session sees ts as %s, want it in UTC", text)
+    }
+}
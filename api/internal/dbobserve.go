@@ -0,0 +1,376 @@
+package internal
+
+import (
+    "context"
+    "database/sql/driver"
+    "io"
+    "reflect"
+    "strings"
+    "time"
+
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/trace"
+)
+
+// observedConnector wraps a driver.Connector so every statement its
+// connections run is observed. One taking longer than the slow threshold is
+// logged with its SQL text and duration (until its first rows arrive, not
+// until they have all been read); while tracing is on, each gets a client
+// span, from the start of the statement until its rows are closed, tagged
+// with the operation and the number of rows returned or affected. Only the
+// parameterized SQL is logged or traced, never the bound values, which may
+// hold personal data. For a positional dialect it also rewrites each
+// statement's ? placeholders to $n before the driver sees it.
+type observedConnector struct {
+    driver.Connector
+    obs queryObserver
+}
+
+func (c observedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+    conn, err := c.Connector.Connect(ctx)
+    if err != nil {
+        return nil, err
+    }
+    return &observedConn{Conn: conn, obs: c.obs}, nil
+}
+
+// queryObserver says what to do with each statement: log it past slow
+// (zero never logs), trace it with tracer (nil doesn't) as a statement to
+// system, and rebind it when positional.
+type queryObserver struct {
+    system     string
+    slow       time.Duration
+    tracer     trace.Tracer
+    positional bool
+}
+
+// sql is query as the driver should get it.
+func (o queryObserver) sql(query string) string {
+    if o.positional {
+        return rebind(query)
+    }
+    return query
+}
+
+// args is args as the driver should get them. pgx stores a time.Time in a
+// TIMESTAMP column by its wall clock, so for a positional dialect times go
+// in as UTC, as the MySQL driver's Loc makes them.
+func (o queryObserver) args(args []driver.NamedValue) []driver.NamedValue {
+    if !o.positional {
+        return args
+    }
+    var out []driver.NamedValue
+    for i, a := range args {
+        if t, ok := a.Value.(time.Time); ok && t.Location() != time.UTC {
+            if out == nil {
+                out = append(out, args...)
+            }
+            out[i].Value = t.UTC()
+        }
+    }
+    if out == nil {
+        return args
+    }
+    return out
+}
+
+// queryRun is one run of a statement.
+type queryRun struct {
+    ctx   context.Context
+    obs   queryObserver
+    query string
+    start time.Time
+    span  trace.Span
+}
+
+func (o queryObserver) begin(ctx context.Context, query string) *queryRun {
+    return &queryRun{ctx: ctx, obs: o, query: query, start: time.Now()}
+}
+
+// returned records that the driver has answered: a slow run is logged and
+// its span started, dated from when the run began. It isn't called for a
+// driver.ErrSkip, which means the statement didn't run.
+func (q *queryRun) returned(err error) {
+    d := time.Since(q.start)
+    slow := q.obs.slow > 0 && d > q.obs.slow
+    if !slow && q.obs.tracer == nil {
+        return
+    }
+    query := strings.Join(strings.Fields(q.query), " ")
+    if slow {
+        logRequest(RequestIDFromContext(q.ctx), "slow query (%s): %s", d.Round(time.Millisecond), query)
+    }
+    if q.obs.tracer == nil {
+        return
+    }
+    op := sqlOperation(query)
+    _, q.span = q.obs.tracer.Start(q.ctx, op,
+        trace.WithSpanKind(trace.SpanKindClient),
+        trace.WithTimestamp(q.start),
+        trace.WithAttributes(
+            attribute.String("db.system", q.obs.system),
+            attribute.String("db.operation.name", op),
+            attribute.String("db.query.text", query),
+        ))
+    if err != nil {
+        q.span.RecordError(err)
+        q.span.SetStatus(codes.Error, err.Error())
+    }
+}
+
+// finish ends the run's span, tagging it with key = rows.
+func (q *queryRun) finish(key string, rows int64) {
+    if q.span != nil {
+        q.span.SetAttributes(attribute.Int64(key, rows))
+        q.span.End()
+    }
+}
+
+// exec finishes an Exec run with the rows it affected.
+func (q *queryRun) exec(res driver.Result, err error) (driver.Result, error) {
+    q.returned(err)
+    var n int64
+    if err == nil {
+        n, _ = res.RowsAffected()
+    }
+    q.finish("db.response.affected_rows", n)
+    return res, err
+}
+
+// rows hands a Query run's rows back, counting them for its span when
+// there is one.
+func (q *queryRun) rows(rows driver.Rows, err error) (driver.Rows, error) {
+    q.returned(err)
+    if err != nil {
+        q.finish("db.response.returned_rows", 0)
+        return nil, err
+    }
+    if q.span == nil {
+        return rows, nil
+    }
+    return &observedRows{Rows: rows, run: q}, nil
+}
+
+// sqlOperation is the statement's leading keyword, such as SELECT.
+func sqlOperation(query string) string {
+    op, _, _ := strings.Cut(query, " ")
+    return strings.ToUpper(op)
+}
+
+// observedConn observes the statements run on one connection. It forwards
+// the optional driver interfaces database/sql looks for, so wrapping a
+// connection doesn't change how it is used.
+type observedConn struct {
+    driver.Conn
+    obs queryObserver
+}
+
+func (c *observedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+    q, ok := c.Conn.(driver.QueryerContext)
+    if !ok {
+        return nil, driver.ErrSkip
+    }
+    query, args = c.obs.sql(query), c.obs.args(args)
+    run := c.obs.begin(ctx, query)
+    rows, err := q.QueryContext(ctx, query, args)
+    // ErrSkip means the driver didn't run it; database/sql prepares it
+    // instead, and the statement is observed then.
+    if err == driver.ErrSkip {
+        return nil, err
+    }
+    return run.rows(rows, err)
+}
+
+func (c *observedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+    e, ok := c.Conn.(driver.ExecerContext)
+    if !ok {
+        return nil, driver.ErrSkip
+    }
+    query, args = c.obs.sql(query), c.obs.args(args)
+    run := c.obs.begin(ctx, query)
+    res, err := e.ExecContext(ctx, query, args)
+    if err == driver.ErrSkip {
+        return nil, err
+    }
+    return run.exec(res, err)
+}
+
+func (c *observedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+    query = c.obs.sql(query)
+    var stmt driver.Stmt
+    var err error
+    if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+        stmt, err = p.PrepareContext(ctx, query)
+    } else {
+        stmt, err = c.Conn.Prepare(query)
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &observedStmt{Stmt: stmt, query: query, obs: c.obs}, nil
+}
+
+func (c *observedConn) Prepare(query string) (driver.Stmt, error) {
+    return c.PrepareContext(context.Background(), query)
+}
+
+func (c *observedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+    if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+        return b.BeginTx(ctx, opts)
+    }
+    return c.Conn.Begin()
+}
+
+func (c *observedConn) Ping(ctx context.Context) error {
+    if p, ok := c.Conn.(driver.Pinger); ok {
+        return p.Ping(ctx)
+    }
+    return nil
+}
+
+func (c *observedConn) ResetSession(ctx context.Context) error {
+    if r, ok := c.Conn.(driver.SessionResetter); ok {
+        return r.ResetSession(ctx)
+    }
+    return nil
+}
+
+func (c *observedConn) IsValid() bool {
+    if v, ok := c.Conn.(driver.Validator); ok {
+        return v.IsValid()
+    }
+    return true
+}
+
+func (c *observedConn) CheckNamedValue(nv *driver.NamedValue) error {
+    if ch, ok := c.Conn.(driver.NamedValueChecker); ok {
+        return ch.CheckNamedValue(nv)
+    }
+    return driver.ErrSkip
+}
+
+// observedStmt observes executions of a prepared statement, which is how
+// database/sql runs queries with arguments when the driver doesn't
+// interpolate them.
+type observedStmt struct {
+    driver.Stmt
+    query string
+    obs   queryObserver
+}
+
+func (s *observedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+    args = s.obs.args(args)
+    run := s.obs.begin(ctx, s.query)
+    if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+        return run.exec(e.ExecContext(ctx, args))
+    }
+    vals, err := namedValues(args)
+    if err != nil {
+        return nil, err
+    }
+    return run.exec(s.Stmt.Exec(vals))
+}
+
+func (s *observedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+    args = s.obs.args(args)
+    run := s.obs.begin(ctx, s.query)
+    if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+        return run.rows(q.QueryContext(ctx, args))
+    }
+    vals, err := namedValues(args)
+    if err != nil {
+        return nil, err
+    }
+    return run.rows(s.Stmt.Query(vals))
+}
+
+func (s *observedStmt) CheckNamedValue(nv *driver.NamedValue) error {
+    if ch, ok := s.Stmt.(driver.NamedValueChecker); ok {
+        return ch.CheckNamedValue(nv)
+    }
+    return driver.ErrSkip
+}
+
+// namedValues converts args for the pre-context Stmt methods, which take
+// positional values only.
+func namedValues(args []driver.NamedValue) ([]driver.Value, error) {
+    vals := make([]driver.Value, len(args))
+    for i, a := range args {
+        if a.Name != "" {
+            return nil, driver.ErrSkip
+        }
+        vals[i] = a.Value
+    }
+    return vals, nil
+}
+
+// observedRows counts the rows read for a traced query and ends its span
+// when they are closed. The column type methods are forwarded, with
+// database/sql's defaults for a driver that lacks them.
+type observedRows struct {
+    driver.Rows
+    run *queryRun
+    n   int64
+}
+
+func (r *observedRows) Next(dest []driver.Value) error {
+    err := r.Rows.Next(dest)
+    if err == nil {
+        r.n++
+    }
+    return err
+}
+
+func (r *observedRows) Close() error {
+    err := r.Rows.Close()
+    r.run.finish("db.response.returned_rows", r.n)
+    return err
+}
+
+func (r *observedRows) HasNextResultSet() bool {
+    rs, ok := r.Rows.(driver.RowsNextResultSet)
+    return ok && rs.HasNextResultSet()
+}
+
+func (r *observedRows) NextResultSet() error {
+    if rs, ok := r.Rows.(driver.RowsNextResultSet); ok {
+        return rs.NextResultSet()
+    }
+    return io.EOF
+}
+
+func (r *observedRows) ColumnTypeScanType(i int) reflect.Type {
+    if c, ok := r.Rows.(driver.RowsColumnTypeScanType); ok {
+        return c.ColumnTypeScanType(i)
+    }
+    return reflect.TypeFor[any]()
+}
+
+func (r *observedRows) ColumnTypeDatabaseTypeName(i int) string {
+    if c, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+        return c.ColumnTypeDatabaseTypeName(i)
+    }
+    return ""
+}
+
+func (r *observedRows) ColumnTypeLength(i int) (int64, bool) {
+    if c, ok := r.Rows.(driver.RowsColumnTypeLength); ok {
+        return c.ColumnTypeLength(i)
+    }
+    return 0, false
+}
+
+func (r *observedRows) ColumnTypeNullable(i int) (bool, bool) {
+    if c, ok := r.Rows.(driver.RowsColumnTypeNullable); ok {
+        return c.ColumnTypeNullable(i)
+    }
+    return false, false
+}
+
+func (r *observedRows) ColumnTypePrecisionScale(i int) (int64, int64, bool) {
+    if c, ok := r.Rows.(driver.RowsColumnTypePrecisionScale); ok {
+        return c.ColumnTypePrecisionScale(i)
+    }
+    return 0, 0, false
+}
@@ -0,0 +1,66 @@
+package internal
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "mime"
+    "net/http"
+)
+
+// readJSONBody checks that the request declares a JSON body and reads at
+// most limit bytes of it. On failure it writes the response and returns
+// false: 415 for a non-JSON Content-Type, 413 for an oversized body.
+func readJSONBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, bool) {
+    mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+    if err != nil || mt != "application/json" {
+        writeError(w, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "Content-Type must be application/json")
+        return nil, false
+    }
+
+    body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+    if err != nil {
+        var tooBig *http.MaxBytesError
+        if errors.As(err, &tooBig) {
+            writeError(w, http.StatusRequestEntityTooLarge, CodeTooLarge, fmt.Sprintf("request body exceeds %d bytes", limit))
+            return nil, false
+        }
+        writeError(w, 400, CodeInvalidBody, "could not read request body")
+        return nil, false
+    }
+    return body, true
+}
+
+// unmarshalBody decodes a body read by readJSONBody into dst, writing a 400
+// that says what was wrong when it can't.
+func unmarshalBody(w http.ResponseWriter, body []byte, dst any) bool {
+    err := json.Unmarshal(body, dst)
+    if err == nil {
+        return true
+    }
+
+    var typeErr *json.UnmarshalTypeError
+    switch {
+    case len(body) == 0:
+        writeError(w, 400, CodeInvalidBody, "request body is empty")
+    case errors.As(err, &typeErr) && typeErr.Field != "":
+        writeError(w, 400, CodeInvalidBody, fmt.Sprintf("field %q must be of type %s", typeErr.Field, typeErr.Type))
+    case errors.As(err, &typeErr):
+        writeError(w, 400, CodeInvalidBody, fmt.Sprintf("request body must be a JSON %s", typeErr.Type))
+    default:
+        writeError(w, 400, CodeInvalidBody, "request body is malformed JSON")
+    }
+    return false
+}
+
+// decodeJSON reads and decodes a JSON request body of at most maxBodyBytes
+// into dst. On failure it has already written the error response.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+    return decodeJSONLimit(w, r, dst, maxBodyBytes)
+}
+
+func decodeJSONLimit(w http.ResponseWriter, r *http.Request, dst any, limit int64) bool {
+    body, ok := readJSONBody(w, r, limit)
+    return ok && unmarshalBody(w, body, dst)
+}
@@ -0,0 +1,222 @@
+package internal
+
+import (
+    "context"
+    "database/sql"
+    "database/sql/driver"
+    "errors"
+    "fmt"
+    "io/fs"
+    "sort"
+    "strconv"
+    "strings"
+
+    "github.com/go-sql-driver/mysql"
+)
+
+// Dialect is what differs between the databases the API can run on. The
+// repo code writes its SQL once, with ? placeholders and the portable subset
+// both databases accept, and asks the dialect for the rest: how to connect,
+// how to get an inserted row's id, what a driver error means, and the few
+// expressions that can't be written portably.
+type Dialect interface {
+    // Name is the DB_DRIVER value that selects the dialect.
+    Name() string
+    // connector returns a connector for the primary described by cfg, or
+    // for dsn when it is set (the replica).
+    connector(cfg *Config, dsn string) (driver.Connector, error)
+    // positional reports whether the driver wants $1-style placeholders,
+    // which the DB wrapper then rewrites the repo's ? to (see rebind).
+    positional() bool
+    // insertID runs an INSERT into a table with an id column and returns
+    // the new row's id.
+    insertID(ctx context.Context, tx *sql.Tx, query string, args ...any) (int64, error)
+    // classify reports which of the errors the API handles err is, or
+    // dbErrOther.
+    classify(err error) dbErrorKind
+    // secondsAgo is an expression for the time a ? argument's number of
+    // seconds before now.
+    secondsAgo() string
+    // ageSeconds is an expression for the seconds elapsed since col.
+    ageSeconds(col string) string
+    // like is the operator for a case-insensitive LIKE.
+    like() string
+    // jsonKey is an expression for the text of a top-level key, given as a
+    // ? argument, of the JSON object stored in col.
+    jsonKey(col string) string
+    // deleteLimit deletes at most a ? argument's number of rows of table
+    // matching where.
+    deleteLimit(table, where string) string
+    // lockMigrations takes the lock Migrate holds on conn while it runs.
+    lockMigrations(ctx context.Context, conn *sql.Conn) (release func(), err error)
+    // migrationsTable creates schema_migrations if it is missing.
+    migrationsTable() string
+    // migrations holds the dialect's NNNN_description.sql files.
+    migrations() fs.FS
+}
+
+// dbErrorKind is a driver error the API handles specifically, whichever
+// database raised it.
+type dbErrorKind int
+
+const (
+    dbErrOther dbErrorKind = iota
+    // dbErrDuplicate is a unique-constraint violation.
+    dbErrDuplicate
+    // dbErrReferenced is deleting or re-keying a row others still reference.
+    dbErrReferenced
+    // dbErrNoReferenced is referencing a row that doesn't exist.
+    dbErrNoReferenced
+    // dbErrDeadlock and dbErrLockTimeout are lock conflicts after which the
+    // transaction was rolled back and can simply be run again.
+    dbErrDeadlock
+    dbErrLockTimeout
+    // dbErrNoSuchTable is a query on a table that doesn't exist yet.
+    dbErrNoSuchTable
+)
+
+// dialects holds the dialects compiled in, by name. MySQL always is;
+// Postgres registers itself when built with -tags postgres.
+var dialects = map[string]Dialect{"mysql": mysqlDialect{}}
+
+// dialect is the one in use, set by OpenDB from Config.DBDriver.
+var dialect Dialect = mysqlDialect{}
+
+// lookupDialect returns the dialect DB_DRIVER names.
+func lookupDialect(name string) (Dialect, error) {
+    if d, ok := dialects[name]; ok {
+        return d, nil
+    }
+    if name == "postgres" {
+        return nil, fmt.Errorf("DB_DRIVER=postgres needs a build with -tags postgres")
+    }
+    names := make([]string, 0, len(dialects))
+    for n := range dialects {
+        names = append(names, n)
+    }
+    sort.Strings(names)
+    return nil, fmt.Errorf("DB_DRIVER=%q must be one of %s", name, strings.Join(names, ", "))
+}
+
+// insertID runs an INSERT in tx with the dialect in use and returns the new
+// row's id.
+func insertID(ctx context.Context, tx *sql.Tx, query string, args ...any) (int64, error) {
+    return dialect.insertID(ctx, tx, query, args...)
+}
+
+// rebind rewrites the ? placeholders in query as $1, $2 and so on, leaving
+// any ? inside a quoted string or identifier alone.
+func rebind(query string) string {
+    if !strings.Contains(query, "?") {
+        return query
+    }
+    var b strings.Builder
+    n := 0
+    var quote byte
+    for i := 0; i < len(query); i++ {
+        ch := query[i]
+        switch {
+        case quote != 0:
+            if ch == quote {
+                quote = 0
+            }
+        case ch == '\'' || ch == '"' || ch == '`':
+            quote = ch
+        case ch == '?':
+            n++
+            b.WriteString("$" + strconv.Itoa(n))
+            continue
+        }
+        b.WriteByte(ch)
+    }
+    return b.String()
+}
+
+// mysqlDialect is the default, and the dialect the schema was written for.
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string { return "mysql" }
+
+func (mysqlDialect) connector(cfg *Config, dsn string) (driver.Connector, error) {
+    mc := buildConfig(cfg.DBHost, cfg.DBPort, cfg.DBName, cfg.DBUser, cfg.DBPass)
+    if dsn != "" {
+        var err error
+        if mc, err = mysql.ParseDSN(dsn); err != nil {
+            return nil, err
+        }
+        setDriverOptions(mc)
+    }
+    return mysql.NewConnector(mc)
+}
+
+func (mysqlDialect) positional() bool { return false }
+
+func (mysqlDialect) insertID(ctx context.Context, tx *sql.Tx, query string, args ...any) (int64, error) {
+    res, err := tx.ExecContext(ctx, query, args...)
+    if err != nil {
+        return 0, err
+    }
+    return res.LastInsertId()
+}
+
+// MySQL server error numbers the API handles specifically.
+var mysqlErrorKinds = map[uint16]dbErrorKind{
+    1062: dbErrDuplicate,
+    1451: dbErrReferenced,
+    1452: dbErrNoReferenced,
+    1213: dbErrDeadlock,
+    1205: dbErrLockTimeout,
+    1146: dbErrNoSuchTable,
+}
+
+func (mysqlDialect) classify(err error) dbErrorKind {
+    var me *mysql.MySQLError
+    if errors.As(err, &me) {
+        return mysqlErrorKinds[me.Number]
+    }
+    return dbErrOther
+}
+
+func (mysqlDialect) secondsAgo() string { return "NOW() - INTERVAL ? SECOND" }
+
+func (mysqlDialect) ageSeconds(col string) string {
+    return "TIMESTAMPDIFF(SECOND, " + col + ", NOW())"
+}
+
+// like is plain LIKE: the utf8mb4 columns' default collation is already
+// case-insensitive.
+func (mysqlDialect) like() string { return "LIKE" }
+
+func (mysqlDialect) jsonKey(col string) string {
+    return `JSON_UNQUOTE(JSON_EXTRACT(` + col + `, CONCAT('$."', ?, '"')))`
+}
+
+func (mysqlDialect) deleteLimit(table, where string) string {
+    return "DELETE FROM " + table + " WHERE " + where + " LIMIT ?"
+}
+
+// lockMigrations takes a named lock. GET_LOCK is per connection, which is
+// why Migrate pins one for the whole run.
+func (mysqlDialect) lockMigrations(ctx context.Context, conn *sql.Conn) (func(), error) {
+    var locked int
+    if err := conn.QueryRowContext(ctx, `SELECT GET_LOCK('schema_migrations', 60)`).Scan(&locked); err != nil {
+        return nil, err
+    }
+    if locked != 1 {
+        return nil, fmt.Errorf("migrate: timed out waiting for the migration lock")
+    }
+    return func() { conn.ExecContext(context.Background(), `SELECT RELEASE_LOCK('schema_migrations')`) }, nil
+}
+
+func (mysqlDialect) migrationsTable() string {
+    return `CREATE TABLE IF NOT EXISTS schema_migrations (
+        version    INT UNSIGNED NOT NULL,
+        applied_at TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (version)
+    ) ENGINE=InnoDB`
+}
+
+func (mysqlDialect) migrations() fs.FS {
+    sub, _ := fs.Sub(migrationFS, "migrations")
+    return sub
+}
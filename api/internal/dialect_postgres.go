@@ -0,0 +1,136 @@
+//go:build postgres
+
+package internal
+
+import (
+    "context"
+    "database/sql"
+    "database/sql/driver"
+    "embed"
+    "errors"
+    "fmt"
+    "io/fs"
+    "strconv"
+    "strings"
+
+    "github.com/jackc/pgx/v5"
+    "github.com/jackc/pgx/v5/pgconn"
+    "github.com/jackc/pgx/v5/stdlib"
+)
+
+// Postgres support is compiled in only with -tags postgres, so the default
+// build doesn't carry the pgx driver.
+func init() {
+    dialects["postgres"] = postgresDialect{}
+}
+
+//go:embed migrations/postgres/*.sql
+var postgresMigrationFS embed.FS
+
+// postgresDialect runs the API on Postgres through pgx. Its schema matches
+// the MySQL one column for column, with TIMESTAMP columns read in a UTC
+// session so times scan exactly as they do from MySQL.
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string { return "postgres" }
+
+// connector builds the config field by field for the primary, like
+// buildConfig, and parses dsn (a postgres:// URL or key=value string) for
+// the replica.
+func (postgresDialect) connector(cfg *Config, dsn string) (driver.Connector, error) {
+    pc, err := pgx.ParseConfig(dsn)
+    if err != nil {
+        return nil, err
+    }
+    if dsn == "" {
+        port, err := strconv.ParseUint(cfg.DBPort, 10, 16)
+        if err != nil {
+            return nil, fmt.Errorf("DB_PORT=%q: %w", cfg.DBPort, err)
+        }
+        pc.Host, pc.Port, pc.Database = cfg.DBHost, uint16(port), cfg.DBName
+        pc.User, pc.Password = cfg.DBUser, cfg.DBPass
+    }
+    pc.RuntimeParams["timezone"] = "UTC"
+    return stdlib.GetConnector(*pc), nil
+}
+
+func (postgresDialect) positional() bool { return true }
+
+// insertID asks for the id back with RETURNING, since Postgres has no
+// LastInsertId.
+func (postgresDialect) insertID(ctx context.Context, tx *sql.Tx, query string, args ...any) (int64, error) {
+    var id int64
+    err := tx.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id)
+    return id, err
+}
+
+// Postgres SQLSTATEs the API handles specifically. A serialization failure
+// is retried like a deadlock.
+var postgresErrorKinds = map[string]dbErrorKind{
+    "23505": dbErrDuplicate,
+    "23001": dbErrReferenced,
+    "23503": dbErrNoReferenced,
+    "40P01": dbErrDeadlock,
+    "40001": dbErrDeadlock,
+    "55P03": dbErrLockTimeout,
+    "42P01": dbErrNoSuchTable,
+}
+
+func (postgresDialect) classify(err error) dbErrorKind {
+    var pe *pgconn.PgError
+    if !errors.As(err, &pe) {
+        return dbErrOther
+    }
+    // 23503 covers both sides of a foreign key; deleting a referenced row
+    // is the one whose message starts this way.
+    if pe.Code == "23503" && strings.HasPrefix(pe.Message, "update or delete") {
+        return dbErrReferenced
+    }
+    return postgresErrorKinds[pe.Code]
+}
+
+func (postgresDialect) secondsAgo() string {
+    return "NOW() - make_interval(secs => CAST(? AS BIGINT))"
+}
+
+func (postgresDialect) ageSeconds(col string) string {
+    return "EXTRACT(EPOCH FROM NOW() - " + col + ")"
+}
+
+func (postgresDialect) like() string { return "ILIKE" }
+
+// jsonKey types the key as text, since ->> also takes an array index.
+func (postgresDialect) jsonKey(col string) string {
+    return col + " ->> CAST(? AS TEXT)"
+}
+
+// deleteLimit picks the rows in a subquery, since Postgres DELETE has no
+// LIMIT.
+func (postgresDialect) deleteLimit(table, where string) string {
+    return "DELETE FROM " + table + " WHERE id IN (SELECT id FROM " + table + " WHERE " + where + " LIMIT ?)"
+}
+
+// lockMigrations takes a session advisory lock, which like GET_LOCK is held
+// by the connection.
+func (postgresDialect) lockMigrations(ctx context.Context, conn *sql.Conn) (func(), error) {
+    if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock(hashtext('schema_migrations'))`); err != nil {
+        return nil, err
+    }
+    return func() { conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock(hashtext('schema_migrations'))`) }, nil
+}
+
+func (postgresDialect) migrationsTable() string {
+    return `CREATE TABLE IF NOT EXISTS schema_migrations (
+        version    INTEGER   NOT NULL,
+        applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (version)
+    )`
+}
+
+// migrations are separate from MySQL's, but numbered in step with them: the
+// first creates the schema as of MySQL migration 12, and each later MySQL
+// migration needs a Postgres file with the same version.
+func (postgresDialect) migrations() fs.FS {
+    sub, _ := fs.Sub(postgresMigrationFS, "migrations/postgres")
+    return sub
+}
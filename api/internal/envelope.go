@@ -0,0 +1,89 @@
+package internal
+
+import (
+    "errors"
+    "net/http"
+)
+
+// pageShape is how a list response is laid out, chosen with ?envelope=.
+type pageShape int
+
+const (
+    // shapeFlat is the default {"data", "limit", "offset", "total"} object.
+    shapeFlat pageShape = iota
+    // shapeBare is just the data array (?envelope=false); the total is
+    // still in X-Total-Count.
+    shapeBare
+    // shapeNested is {"data", "page": {...}} (?envelope=true).
+    shapeNested
+)
+
+// pageMeta is the "page" object of a nested list response.
+type pageMeta struct {
+    Limit      int    `json:"limit"`
+    Offset     int    `json:"offset"`
+    Total      int    `json:"total"`
+    MaxLimit   int    `json:"max_limit"`
+    NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// pageLimits returns the configured PageLimits of a list resource, falling
+// back to defaultPageLimit and maxPageLimit.
+func (h *Handler) pageLimits(resource string) PageLimits {
+    if pl, ok := h.Config.PageLimits[resource]; ok {
+        return pl
+    }
+    return PageLimits{Default: defaultPageLimit, Max: maxPageLimit}
+}
+
+// parse reads ?limit= and ?offset=. A missing limit is pl.Default and any
+// limit is clamped to 1..pl.Max.
+func (pl PageLimits) parse(r *http.Request) (limit, offset int, err error) {
+    if limit, err = queryInt(r, "limit", pl.Default); err != nil {
+        return 0, 0, err
+    }
+    if offset, err = queryInt(r, "offset", 0); err != nil {
+        return 0, 0, err
+    }
+    return min(max(limit, 1), pl.Max), offset, nil
+}
+
+// meta builds the nested "page" object; cursor is optional.
+func (pl PageLimits) meta(limit, offset, total int, cursor ...string) pageMeta {
+    m := pageMeta{Limit: limit, Offset: offset, Total: total, MaxLimit: pl.Max}
+    if len(cursor) > 0 {
+        m.NextCursor = cursor[0]
+    }
+    return m
+}
+
+type nestedPage struct {
+    Data any      `json:"data"`
+    Page pageMeta `json:"page"`
+}
+
+// parsePageShape reads ?envelope=. Leaving it out keeps the flat envelope
+// existing clients rely on.
+func parsePageShape(r *http.Request) (pageShape, error) {
+    switch r.URL.Query().Get("envelope") {
+    case "":
+        return shapeFlat, nil
+    case "false":
+        return shapeBare, nil
+    case "true":
+        return shapeNested, nil
+    }
+    return 0, errors.New("envelope must be true or false")
+}
+
+// shapePage returns the body to send for a list page: flat unchanged, or
+// data alone or wrapped with meta as shape asks.
+func shapePage(shape pageShape, flat, data any, meta pageMeta) any {
+    switch shape {
+    case shapeBare:
+        return data
+    case shapeNested:
+        return nestedPage{Data: data, Page: meta}
+    }
+    return flat
+}
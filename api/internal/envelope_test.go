@@ -0,0 +1,110 @@
+package internal
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "testing"
+)
+
+func TestListCustomersEnvelope(t *testing.T) {
+    h, _ := newStubHandler(testCustomers(3)...)
+    get := func(query string) *httptest.ResponseRecorder {
+        rec := httptest.NewRecorder()
+        h.ListCustomers(rec, httptest.NewRequest("GET", "/api/customers?limit=2"+query, nil))
+        return rec
+    }
+    decode := func(name string, rec *httptest.ResponseRecorder, v any) {
+        t.Helper()
+        if rec.Code != http.StatusOK {
+            t.Fatalf("%s: status %d: %s", name, rec.Code, rec.Body)
+        }
+        if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+            t.Fatalf("%s: %v: %s", name, err, rec.Body)
+        }
+        if got := rec.Header().Get("X-Total-Count"); got != "3" {
+            t.Errorf("%s: X-Total-Count %q, want 3", name, got)
+        }
+    }
+
+    // Absent is the flat shape existing clients rely on.
+    var flat map[string]json.RawMessage
+    decode("absent", get(""), &flat)
+    for _, k := range []string{"data", "limit", "offset", "total", "max_limit"} {
+        if _, ok := flat[k]; !ok {
+            t.Errorf("absent: no %q in %s", k, mustJSON(t, flat))
+        }
+    }
+    if _, ok := flat["page"]; ok {
+        t.Error(`absent: flat body has a "page" object`)
+    }
+
+    var nested struct {
+        Data json.RawMessage `json:"data"`
+        Page pageMeta        `json:"page"`
+    }
+    decode("true", get("&envelope=true"), &nested)
+    var bare json.RawMessage
+    decode("false", get("&envelope=false"), &bare)
+
+    // The three shapes carry the same page.
+    var flatPage customerPage
+    if err := json.Unmarshal(mustJSON(t, flat), &flatPage); err != nil {
+        t.Fatal(err)
+    }
+    want := pageMeta{Limit: 2, Offset: 0, Total: 3, MaxLimit: maxPageLimit}
+    if got := (pageMeta{Limit: flatPage.Limit, Offset: flatPage.Offset, Total: flatPage.Total, MaxLimit: flatPage.MaxLimit}); got != want {
+        t.Errorf("absent: page %+v, want %+v", got, want)
+    }
+    if nested.Page != want {
+        t.Errorf("true: page %+v, want %+v", nested.Page, want)
+    }
+    if !jsonEqual(t, flat["data"], nested.Data) || !jsonEqual(t, flat["data"], bare) {
+        t.Errorf("data differs: flat %s, nested %s, bare %s", flat["data"], nested.Data, bare)
+    }
+    var ids []struct{ ID int }
+    if err := json.Unmarshal(bare, &ids); err != nil || len(ids) != 2 || ids[0].ID != 3 {
+        t.Errorf("false: body %s, want the 2 newest customers as an array", bare)
+    }
+
+    // An empty value is the same as leaving it out.
+    var empty map[string]json.RawMessage
+    decode("empty", get("&envelope="), &empty)
+    if !jsonEqual(t, mustJSON(t, empty), mustJSON(t, flat)) {
+        t.Errorf("empty: body %s, want the flat %s", mustJSON(t, empty), mustJSON(t, flat))
+    }
+
+    for _, bad := range []string{"&envelope=1", "&envelope=yes", "&envelope=TRUE"} {
+        rec := get(bad)
+        if rec.Code != http.StatusBadRequest {
+            t.Errorf("%s: status %d, want 400", bad, rec.Code)
+            continue
+        }
+        if code := errorCode(t, rec); code != CodeInvalidParameter {
+            t.Errorf("%s: code %q, want %q", bad, code, CodeInvalidParameter)
+        }
+    }
+}
+
+func mustJSON(t *testing.T, v any) []byte {
+    t.Helper()
+    b, err := json.Marshal(v)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return b
+}
+
+// jsonEqual reports whether a and b encode the same value.
+func jsonEqual(t *testing.T, a, b json.RawMessage) bool {
+    t.Helper()
+    var x, y any
+    if err := json.Unmarshal(a, &x); err != nil {
+        t.Fatal(err)
+    }
+    if err := json.Unmarshal(b, &y); err != nil {
+        t.Fatal(err)
+    }
+    return reflect.DeepEqual(x, y)
+}
@@ -0,0 +1,85 @@
+package internal
+
+import (
+    "context"
+    "errors"
+    "net/http"
+)
+
+// errorBody is the JSON shape of every error response:
+// {"error":{"code":"...","message":"...","request_id":"..."}}.
+type errorBody struct {
+    Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+    Code      ErrorCode `json:"code"`
+    Message   string    `json:"message"`
+    RequestID string    `json:"request_id,omitempty"`
+    // Details lists each failing field of a validation_failed error.
+    Details   []fieldError `json:"details,omitempty"`
+}
+
+// newErrorDetail builds an error carrying the request ID, which RequestID
+// has already set on the response header.
+func newErrorDetail(w http.ResponseWriter, code ErrorCode, message string) errorDetail {
+    return errorDetail{Code: code, Message: message, RequestID: w.Header().Get(requestIDHeader)}
+}
+
+func writeError(w http.ResponseWriter, status int, code ErrorCode, message string) {
+    writeJSON(w, status, errorBody{Error: newErrorDetail(w, code, message)})
+}
+
+// dbErrors maps the database errors a client can act on to the response
+// they get. Anything not listed is an internal error.
+var dbErrors = map[dbErrorKind]errorResponse{
+    dbErrDuplicate:    {409, CodeDuplicate, "a record with that value already exists"},
+    dbErrReferenced:   {409, CodeConflict, "the record is still referenced by other records"},
+    dbErrNoReferenced: {409, CodeConflict, "a referenced record does not exist"},
+    dbErrDeadlock:     {503, CodeDBUnavailable, "the request conflicted with a concurrent write; retry it"},
+    dbErrLockTimeout:  {503, CodeDBUnavailable, "the request conflicted with a concurrent write; retry it"},
+}
+
+type errorResponse struct {
+    status  int
+    code    ErrorCode
+    message string
+}
+
+// mapDBError returns the response for a database error the client can act
+// on, and false for anything that should be reported as internal.
+func mapDBError(err error) (errorResponse, bool) {
+    if errors.Is(err, context.DeadlineExceeded) {
+        return errorResponse{http.StatusGatewayTimeout, CodeTimeout, "database query timed out"}, true
+    }
+    if errors.Is(err, ErrCircuitOpen) {
+        return errorResponse{http.StatusServiceUnavailable, CodeDBUnavailable, "the database is unavailable; retry shortly"}, true
+    }
+    resp, ok := dbErrors[dialect.classify(err)]
+    return resp, ok
+}
+
+// dbError reports a failed database call: 504 when the query ran out of
+// time (which is logged), 503 while the circuit breaker is open, the
+// dbErrors entry for a known server error, and 500 otherwise.
+// The driver error is logged but never sent to the client, since it can
+// carry SQL and schema details.
+func dbError(w http.ResponseWriter, err error) {
+    if errors.Is(err, context.DeadlineExceeded) {
+        logRequest(w.Header().Get(requestIDHeader), "db query cancelled at its deadline: %v", err)
+    }
+    if resp, ok := mapDBError(err); ok {
+        if resp.status == http.StatusServiceUnavailable {
+            w.Header().Set("Retry-After", "1")
+        }
+        writeError(w, resp.status, resp.code, resp.message)
+        return
+    }
+    logRequest(w.Header().Get(requestIDHeader), "db error: %v", err)
+    writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+}
+
+// isDuplicateKey reports whether err is a unique-constraint violation.
+func isDuplicateKey(err error) bool {
+    return dialect.classify(err) == dbErrDuplicate
+}
@@ -0,0 +1,136 @@
+package internal
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/go-sql-driver/mysql"
+)
+
+func TestDBErrorMySQLCodes(t *testing.T) {
+    quietLog(t)
+    for _, tc := range []struct {
+        name   string
+        err    error
+        status int
+        code   ErrorCode
+    }{
+        {"duplicate key", &mysql.MySQLError{Number: 1062}, 409, CodeDuplicate},
+        {"row is referenced", &mysql.MySQLError{Number: 1451}, 409, CodeConflict},
+        {"no referenced row", &mysql.MySQLError{Number: 1452}, 409, CodeConflict},
+        {"deadlock", &mysql.MySQLError{Number: 1213}, 503, CodeDBUnavailable},
+        {"lock wait timeout", &mysql.MySQLError{Number: 1205}, 503, CodeDBUnavailable},
+        {"no such table", &mysql.MySQLError{Number: 1146}, 500, CodeInternal},
+        {"syntax error", &mysql.MySQLError{Number: 1064}, 500, CodeInternal},
+        {"wrapped duplicate key", fmt.Errorf("insert customer: %w", &mysql.MySQLError{Number: 1062}), 409, CodeDuplicate},
+        {"wrapped deadlock", fmt.Errorf("tx: %w", fmt.Errorf("update: %w", &mysql.MySQLError{Number: 1213})), 503, CodeDBUnavailable},
+        {"not a MySQL error", errors.New("driver: bad connection"), 500, CodeInternal},
+    } {
+        resp, ok := mapDBError(tc.err)
+        if want := tc.status != 500; ok != want || (ok && resp.status != tc.status) {
+            t.Errorf("%s: mapDBError = %d, %v; want %d", tc.name, resp.status, ok, tc.status)
+        }
+
+        rec := httptest.NewRecorder()
+        dbError(rec, tc.err)
+        if rec.Code != tc.status {
+            t.Errorf("%s: dbError status %d, want %d", tc.name, rec.Code, tc.status)
+        }
+        if code := errorCode(t, rec); code != tc.code {
+            t.Errorf("%s: code %q, want %q", tc.name, code, tc.code)
+        }
+        if retry := rec.Header().Get("Retry-After"); (tc.status == 503) != (retry != "") {
+            t.Errorf("%s: Retry-After %q", tc.name, retry)
+        }
+    }
+}
+
+func TestIsDuplicateKey(t *testing.T) {
+    for _, tc := range []struct {
+        err  error
+        want bool
+    }{
+        {&mysql.MySQLError{Number: 1062}, true},
+        {fmt.Errorf("bulk create: %w", &mysql.MySQLError{Number: 1062}), true},
+        {&mysql.MySQLError{Number: 1452}, false},
+        {errors.New("duplicate"), false},
+        {nil, false},
+    } {
+        if got := isDuplicateKey(tc.err); got != tc.want {
+            t.Errorf("isDuplicateKey(%v) = %v, want %v", tc.err, got, tc.want)
+        }
+    }
+}
+
+func TestErrorCodes(t *testing.T) {
+    quietLog(t)
+    h := &Handler{Config: &Config{QueryTimeout: time.Second}}
+    keys := NewAPIKeys([]string{"user-key"}, []string{"admin-key"}, nil)
+    protected := RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusNoContent)
+    }), keys)
+    slow := Timeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        <-r.Context().Done()
+    }), 10*time.Millisecond)
+    fail := func(err error) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) { customerError(w, err) }
+    }
+    for _, tc := range []struct {
+        name   string
+        h      http.Handler
+        req    *http.Request
+        status int
+        code   ErrorCode
+    }{
+        {"writeError", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            writeError(w, http.StatusTeapot, CodeInvalidParameter, "short and stout")
+        }), nil, http.StatusTeapot, CodeInvalidParameter},
+        {"no bearer token", protected, httptest.NewRequest("GET", "/api/customers", nil), 401, CodeUnauthorized},
+        {"unknown API key", protected, bearer("GET", "/api/customers", "wrong-key"), 403, CodeForbidden},
+        {"non-admin key on an admin route", protected, bearer("GET", "/api/admin/stats", "user-key"), 403, CodeForbidden},
+        {"not JSON", http.HandlerFunc(h.CreateCustomer), httptest.NewRequest("POST", "/api/customers", strings.NewReader(`{}`)), 415, CodeUnsupportedMediaType},
+        {"malformed body", http.HandlerFunc(h.CreateCustomer), jsonRequest("POST", "/api/customers", `{"name":`), 400, CodeInvalidBody},
+        {"failed validation", http.HandlerFunc(h.CreateCustomer), jsonRequest("POST", "/api/customers", `{"name": "Ada", "email": "not an email"}`), 400, CodeValidationFailed},
+        {"bad customer id", http.HandlerFunc(h.GetCustomer), httptest.NewRequest("GET", "/api/customers/x", nil), 400, CodeInvalidParameter},
+        {"not found", fail(fmt.Errorf("get customer 7: %w", ErrNotFound)), nil, 404, CodeNotFound},
+        {"duplicate", fail(ErrDuplicate), nil, 409, CodeDuplicate},
+        {"duplicate in a batch", fail(&RowError{Index: 2, Err: ErrDuplicate}), nil, 409, CodeDuplicate},
+        {"version conflict", fail(&ConflictError{Current: Customer{ID: 7}}), nil, 409, CodeConflict},
+        {"idempotency key reused", fail(ErrIdempotencyMismatch), nil, 409, CodeConflict},
+        {"modified since", fail(ErrModified), nil, 412, CodePreconditionFailed},
+        {"query timed out", fail(fmt.Errorf("list customers: %w", context.DeadlineExceeded)), nil, 504, CodeTimeout},
+        {"circuit open", fail(ErrCircuitOpen), nil, 503, CodeDBUnavailable},
+        {"unknown db error", fail(errors.New("driver: bad connection")), nil, 500, CodeInternal},
+        {"request timed out", slow, nil, 503, CodeTimeout},
+    } {
+        req := tc.req
+        if req == nil {
+            req = httptest.NewRequest("GET", "/api/customers/7", nil)
+        }
+        rec := httptest.NewRecorder()
+        tc.h.ServeHTTP(rec, req)
+        if rec.Code != tc.status {
+            t.Errorf("%s: status %d, want %d: %s", tc.name, rec.Code, tc.status, rec.Body)
+            continue
+        }
+        if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+            t.Errorf("%s: Content-Type %q", tc.name, ct)
+        }
+        if code := errorCode(t, rec); code != tc.code {
+            t.Errorf("%s: code %q, want %q", tc.name, code, tc.code)
+        }
+    }
+}
+
+// bearer is a request carrying token as its bearer credential.
+func bearer(method, target, token string) *http.Request {
+    req := httptest.NewRequest(method, target, nil)
+    req.Header.Set("Authorization", "Bearer "+token)
+    return req
+}
@@ -0,0 +1,26 @@
+package internal
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "strings"
+)
+
+// etagFor returns a strong ETag for a response body. Hashing the rendered
+// body means any change to any field yields a new tag.
+func etagFor(body []byte) string {
+    sum := sha256.Sum256(body)
+    return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match / If-Match header value lists
+// etag, or is "*". Weak validators compare equal to their strong form.
+func etagMatches(header, etag string) bool {
+    for _, v := range strings.Split(header, ",") {
+        v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+        if v == "*" || v == etag {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,222 @@
+package internal
+
+import (
+    "context"
+    "database/sql"
+    "database/sql/driver"
+    "io"
+    "strconv"
+    "sync"
+    "testing"
+)
+
+// fakeDB is a database/sql driver for tests that need a *sql.DB but no
+// server. Every statement is recorded, with whether it ran in a transaction,
+// and answered by respond; with no respond, or a zero fakeResult, a query
+// returns no rows and an exec affects none. Like a real driver, a statement
+// whose context ended while it ran fails with the context's error.
+type fakeDB struct {
+    respond func(query string, args []driver.Value) fakeResult
+
+    mu         sync.Mutex
+    statements []fakeStatement
+    commits    int
+    rollbacks  int
+}
+
+// fakeStatement is one statement a fakeDB ran.
+type fakeStatement struct {
+    Query string
+    Args  []driver.Value
+    InTx  bool
+}
+
+// fakeResult answers a statement: rows for a query, affected and insertID
+// for an exec, or err for either. Columns may be left out; rows then get
+// placeholder names.
+type fakeResult struct {
+    columns  []string
+    rows     [][]driver.Value
+    affected int64
+    insertID int64
+    err      error
+}
+
+// newFakeDB returns a pool over a new fakeDB answering with respond.
+func newFakeDB(t *testing.T, respond func(query string, args []driver.Value) fakeResult) (*sql.DB, *fakeDB) {
+    t.Helper()
+    f := &fakeDB{respond: respond}
+    db := sql.OpenDB(fakeConnector{f})
+    t.Cleanup(func() { db.Close() })
+    return db, f
+}
+
+// Statements returns the statements run so far, in order.
+func (f *fakeDB) Statements() []fakeStatement {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    return append([]fakeStatement(nil), f.statements...)
+}
+
+// Ended returns how many transactions were committed and rolled back.
+func (f *fakeDB) Ended() (commits, rollbacks int) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    return f.commits, f.rollbacks
+}
+
+func (f *fakeDB) run(query string, args []driver.NamedValue, inTx bool) fakeResult {
+    vals := make([]driver.Value, len(args))
+    for i, a := range args {
+        vals[i] = a.Value
+    }
+    f.mu.Lock()
+    f.statements = append(f.statements, fakeStatement{Query: query, Args: vals, InTx: inTx})
+    f.mu.Unlock()
+    if f.respond == nil {
+        return fakeResult{}
+    }
+    return f.respond(query, vals)
+}
+
+type fakeConnector struct{ f *fakeDB }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return &fakeConn{f: c.f}, nil }
+func (c fakeConnector) Driver() driver.Driver                        { return fakeDriver(c) }
+
+type fakeDriver struct{ f *fakeDB }
+
+func (d fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{f: d.f}, nil }
+
+// fakeConn is one connection; inTx is set while it has a transaction open.
+type fakeConn struct {
+    f    *fakeDB
+    inTx bool
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+    return &fakeStmt{c: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+    return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+    c.inTx = true
+    return fakeTx{c}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+    res := c.f.run(query, args, c.inTx)
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    if res.err != nil {
+        return nil, res.err
+    }
+    return fakeExecResult{res.insertID, res.affected}, nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+    res := c.f.run(query, args, c.inTx)
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    if res.err != nil {
+        return nil, res.err
+    }
+    cols := res.columns
+    if cols == nil && len(res.rows) > 0 {
+        cols = make([]string, len(res.rows[0]))
+        for i := range cols {
+            cols[i] = "c" + strconv.Itoa(i)
+        }
+    }
+    return &fakeRows{columns: cols, rows: res.rows}, nil
+}
+
+// CheckNamedValue converts arguments as drivers usually do, so tests see
+// what a real driver would be sent.
+func (c *fakeConn) CheckNamedValue(nv *driver.NamedValue) error {
+    v, err := driver.DefaultParameterConverter.ConvertValue(nv.Value)
+    if err != nil {
+        return err
+    }
+    nv.Value = v
+    return nil
+}
+
+type fakeTx struct{ c *fakeConn }
+
+func (tx fakeTx) Commit() error {
+    tx.c.inTx = false
+    tx.c.f.mu.Lock()
+    tx.c.f.commits++
+    tx.c.f.mu.Unlock()
+    return nil
+}
+
+func (tx fakeTx) Rollback() error {
+    tx.c.inTx = false
+    tx.c.f.mu.Lock()
+    tx.c.f.rollbacks++
+    tx.c.f.mu.Unlock()
+    return nil
+}
+
+type fakeStmt struct {
+    c     *fakeConn
+    query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+    return s.ExecContext(context.Background(), named(args))
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+    return s.QueryContext(context.Background(), named(args))
+}
+
+func (s *fakeStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+    return s.c.ExecContext(ctx, s.query, args)
+}
+
+func (s *fakeStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+    return s.c.QueryContext(ctx, s.query, args)
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+    out := make([]driver.NamedValue, len(args))
+    for i, v := range args {
+        out[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+    }
+    return out
+}
+
+type fakeExecResult struct{ id, affected int64 }
+
+func (r fakeExecResult) LastInsertId() (int64, error) { return r.id, nil }
+func (r fakeExecResult) RowsAffected() (int64, error) { return r.affected, nil }
+
+type fakeRows struct {
+    columns []string
+    rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+    if len(r.rows) == 0 {
+        return io.EOF
+    }
+    copy(dest, r.rows[0])
+    r.rows = r.rows[1:]
+    return nil
+}
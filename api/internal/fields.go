@@ -0,0 +1,80 @@
+package internal
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strings"
+)
+
+// customerFields are the keys ?fields= may select on customer responses.
+var customerFields = []string{"id", "name", "email", "phone", "version", "created_at", "updated_at", "deleted_at"}
+
+// parseFields reads ?fields= as a comma-separated subset of allowed. It
+// returns nil when the parameter is absent or empty, meaning every field.
+func parseFields(r *http.Request, allowed []string) ([]string, error) {
+    v := r.URL.Query().Get("fields")
+    if strings.TrimSpace(v) == "" {
+        return nil, nil
+    }
+    var fields []string
+    for _, f := range strings.Split(v, ",") {
+        f = strings.TrimSpace(f)
+        if f == "" {
+            continue
+        }
+        if !contains(allowed, f) {
+            return nil, fmt.Errorf("unknown field %q; fields must be drawn from %s", f, strings.Join(allowed, ", "))
+        }
+        fields = append(fields, f)
+    }
+    return fields, nil
+}
+
+func contains(list []string, s string) bool {
+    for _, v := range list {
+        if v == s {
+            return true
+        }
+    }
+    return false
+}
+
+// selectFields re-renders v, a JSON object or array of objects, keeping only
+// the given keys. A nil fields returns v unchanged.
+func selectFields(v any, fields []string) (any, error) {
+    if fields == nil {
+        return v, nil
+    }
+    b, err := json.Marshal(v)
+    if err != nil {
+        return nil, err
+    }
+    if strings.HasPrefix(string(b), "[") {
+        var items []map[string]json.RawMessage
+        if err := json.Unmarshal(b, &items); err != nil {
+            return nil, err
+        }
+        for i := range items {
+            items[i] = pick(items[i], fields)
+        }
+        return items, nil
+    }
+    var obj map[string]json.RawMessage
+    if err := json.Unmarshal(b, &obj); err != nil {
+        return nil, err
+    }
+    return pick(obj, fields), nil
+}
+
+// pick keeps the listed keys of obj. A key the object omitted (an
+// omitempty field) stays omitted.
+func pick(obj map[string]json.RawMessage, fields []string) map[string]json.RawMessage {
+    out := make(map[string]json.RawMessage, len(fields))
+    for _, f := range fields {
+        if v, ok := obj[f]; ok {
+            out[f] = v
+        }
+    }
+    return out
+}
@@ -0,0 +1,141 @@
+package internal
+
+import (
+    "compress/gzip"
+    "net/http"
+    "strings"
+    "sync"
+)
+
+// gzipMinSize is the smallest response worth compressing; below it the gzip
+// framing costs more than it saves.
+const gzipMinSize = 1024
+
+// incompressibleTypes are content-type prefixes that are already compressed
+// (or, for event streams, must not be buffered).
+var incompressibleTypes = []string{
+    "image/", "video/", "audio/", "font/woff",
+    "application/gzip", "application/zip", "application/x-gzip",
+    "application/octet-stream", "text/event-stream",
+}
+
+var gzipPool = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+
+// Gzip compresses responses for clients that send Accept-Encoding: gzip.
+// The first gzipMinSize bytes are buffered to decide: smaller responses and
+// already-compressed content types are sent as-is.
+func Gzip(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Add("Vary", "Accept-Encoding")
+        if !acceptsGzip(r) || r.Method == http.MethodHead {
+            next.ServeHTTP(w, r)
+            return
+        }
+        gw := &gzipWriter{ResponseWriter: w, status: http.StatusOK}
+        defer gw.close()
+        next.ServeHTTP(gw, r)
+    })
+}
+
+func acceptsGzip(r *http.Request) bool {
+    for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+        enc, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+        if strings.TrimSpace(enc) == "gzip" && strings.ReplaceAll(params, " ", "") != "q=0" {
+            return true
+        }
+    }
+    return false
+}
+
+// gzipWriter holds back the status and the start of the body until it knows
+// whether to compress.
+type gzipWriter struct {
+    http.ResponseWriter
+    status      int
+    wroteHeader bool
+    decided     bool
+    buf         []byte
+    gz          *gzip.Writer
+}
+
+func (g *gzipWriter) WriteHeader(status int) {
+    if g.wroteHeader {
+        return
+    }
+    g.wroteHeader = true
+    g.status = status
+    // Bodiless responses have nothing to compress; send them straight on.
+    if status == http.StatusNoContent || status == http.StatusNotModified || status < 200 {
+        g.decide(false)
+    }
+}
+
+func (g *gzipWriter) Write(b []byte) (int, error) {
+    g.wroteHeader = true
+    if !g.decided {
+        g.buf = append(g.buf, b...)
+        if len(g.buf) >= gzipMinSize {
+            g.decide(g.compressible())
+        }
+        return len(b), nil
+    }
+    if g.gz != nil {
+        return g.gz.Write(b)
+    }
+    return g.ResponseWriter.Write(b)
+}
+
+// Flush sends whatever is buffered, deciding early if need be, so streaming
+// handlers keep working through the middleware.
+func (g *gzipWriter) Flush() {
+    if !g.decided {
+        g.decide(g.compressible())
+    }
+    if g.gz != nil {
+        g.gz.Flush()
+    }
+    http.NewResponseController(g.ResponseWriter).Flush()
+}
+
+func (g *gzipWriter) compressible() bool {
+    h := g.Header()
+    if h.Get("Content-Encoding") != "" {
+        return false
+    }
+    ct := h.Get("Content-Type")
+    for _, p := range incompressibleTypes {
+        if strings.HasPrefix(ct, p) {
+            return false
+        }
+    }
+    return true
+}
+
+func (g *gzipWriter) decide(compress bool) {
+    g.decided = true
+    if compress {
+        g.Header().Del("Content-Length")
+        g.Header().Set("Content-Encoding", "gzip")
+    }
+    g.ResponseWriter.WriteHeader(g.status)
+    if compress {
+        g.gz = gzipPool.Get().(*gzip.Writer)
+        g.gz.Reset(g.ResponseWriter)
+        g.gz.Write(g.buf)
+    } else if len(g.buf) > 0 {
+        g.ResponseWriter.Write(g.buf)
+    }
+    g.buf = nil
+}
+
+func (g *gzipWriter) close() {
+    if !g.decided {
+        // Never reached gzipMinSize: send uncompressed.
+        g.decide(false)
+    }
+    if g.gz != nil {
+        g.gz.Close()
+        gzipPool.Put(g.gz)
+        g.gz = nil
+    }
+}
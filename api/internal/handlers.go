@@ -1,44 +1,916 @@
 package internal
 
 import (
+    "bytes"
+    "context"
     "database/sql"
     "encoding/json"
+    "encoding/xml"
+    "errors"
+    "fmt"
     "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gorilla/mux"
 )
 
+// maxBodyBytes caps the size of JSON request bodies accepted by write handlers.
+const maxBodyBytes = 1 << 20
+
 type Handler struct {
-    DB *sql.DB
+    DB        *sql.DB
+    // Replica, if set, serves ReaderDB.
+    Replica   *sql.DB
+    // Breaker and ReplicaBreaker guard DB and Replica's dials; DBStats
+    // reports them.
+    Breaker        *Breaker
+    ReplicaBreaker *Breaker
+    Config    *Config
+    Customers CustomerStore
+    // Maintenance is the flag the maintenance Guard checks; SetMaintenance
+    // needs it set.
+    Maintenance *Maintenance
+    // Webhooks, if set, is sent case events.
+    Webhooks *Webhooks
+
+    stats      statsCache
+    caseEvents caseBroker
+}
+
+// WriterDB is the primary, for writes and for reads that must see them.
+func (h *Handler) WriterDB() *sql.DB { return h.DB }
+
+// ReaderDB is the replica when one is configured and the primary otherwise.
+// Replicas lag, so use it only for reads that tolerate slightly stale rows.
+func (h *Handler) ReaderDB() *sql.DB {
+    if h.Replica != nil {
+        return h.Replica
+    }
+    return h.DB
 }
 
+// dbContext derives the context for a request's database calls from the
+// request context, so queries stop when either the client goes away or the
+// route's query timeout elapses.
+func (h *Handler) dbContext(r *http.Request) (context.Context, context.CancelFunc) {
+    return context.WithTimeout(r.Context(), h.queryTimeout(r))
+}
+
+// queryTimeout is the Config.QueryTimeouts entry for the request's route, or
+// Config.QueryTimeout when it has none.
+func (h *Handler) queryTimeout(r *http.Request) time.Duration {
+    if route := mux.CurrentRoute(r); route != nil {
+        if tpl, err := route.GetPathTemplate(); err == nil {
+            if d, ok := h.Config.QueryTimeouts[tpl]; ok {
+                return d
+            }
+        }
+    }
+    return h.Config.QueryTimeout
+}
+
+// Health is the liveness probe: it answers 200 whenever the process is up
+// and deliberately doesn't touch the database, so a DB blip doesn't get the
+// instance restarted. Ready covers the database. Both report whether
+// maintenance mode is on; it doesn't fail either, since reads still work.
 func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
-    w.Header().Set("Content-Type","application/json")
-    json.NewEncoder(w).Encode(map[string]string{"status":"ok"})
+    writeJSON(w, http.StatusOK, map[string]any{"status":"ok", "maintenance": h.Maintenance.Enabled()})
 }
 
+// readyPingTimeout bounds how long Ready waits on the database.
+const readyPingTimeout = 2 * time.Second
+
+// Ready is the readiness probe: it pings the database (and the replica, if
+// any) and reports 503 until
+// the pool can serve queries and the schema has every migration this build
+// embeds, taking the instance out of rotation meanwhile. A schema ahead of
+// the build is fine, so older instances keep serving during a rollout.
+func (h *Handler) Ready(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), readyPingTimeout)
+    defer cancel()
+
+    start := time.Now()
+    if err := h.DB.PingContext(ctx); err != nil {
+        logRequest(RequestIDFromContext(r.Context()), "ready: db ping failed: %v", err)
+        writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status":"unavailable"})
+        return
+    }
+    latency := float64(time.Since(start).Microseconds()) / 1000
+    if h.Replica != nil {
+        if err := h.Replica.PingContext(ctx); err != nil {
+            logRequest(RequestIDFromContext(r.Context()), "ready: replica ping failed: %v", err)
+            writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status":"unavailable"})
+            return
+        }
+    }
+
+    want, err := expectedSchemaVersion()
+    if err != nil {
+        dbError(w, err)
+        return
+    }
+    have, err := schemaVersion(ctx, h.DB)
+    if err != nil {
+        logRequest(RequestIDFromContext(r.Context()), "ready: reading schema version: %v", err)
+        writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status":"unavailable"})
+        return
+    }
+    if have < want {
+        writeJSON(w, http.StatusServiceUnavailable, map[string]any{
+            "status":"unavailable",
+            "reason": fmt.Sprintf("database schema is at version %d but this build needs %d; run the migrations", have, want),
+        })
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]any{
+        "status":"ok",
+        "db_latency_ms": latency,
+        "schema_version": have,
+        "maintenance": h.Maintenance.Enabled(),
+    })
+}
+
+// Customer timestamps are pointers so NULL columns scan cleanly; they
+// serialize as RFC3339.
 type Customer struct {
-    ID        int     `json:"id"`
-    Name      string  `json:"name"`
-    Email     *string `json:"email,omitempty"`
-    CreatedAt string  `json:"created_at"`
+    XMLName   xml.Name   `json:"-" xml:"customer"`
+    ID        int        `json:"id" xml:"id"`
+    Name      string     `json:"name" xml:"name"`
+    Email     *string    `json:"email" xml:"email,omitempty"`
+    Phone     *string    `json:"phone" xml:"phone,omitempty"`
+    Version   int        `json:"version" xml:"version"`
+    CreatedAt *time.Time `json:"created_at" xml:"created_at"`
+    UpdatedAt *time.Time `json:"updated_at" xml:"updated_at"`
+    DeletedAt *time.Time `json:"deleted_at" xml:"deleted_at,omitempty"`
+}
+
+// customerError reports a failed CustomerStore call, mapping its typed errors
+// to responses and anything else to dbError.
+func customerError(w http.ResponseWriter, err error) {
+    var conflict *ConflictError
+    var rowErr *RowError
+    switch {
+    case errors.As(err, &rowErr) && errors.Is(err, ErrDuplicate):
+        writeError(w, 409, CodeDuplicate, rowErr.Error())
+    case errors.Is(err, ErrNotFound):
+        writeError(w, 404, CodeNotFound, "customer not found")
+    case errors.Is(err, ErrDuplicate):
+        writeError(w, 409, CodeDuplicate, err.Error())
+    case errors.Is(err, ErrModified):
+        writeError(w, http.StatusPreconditionFailed, CodePreconditionFailed, err.Error())
+    case errors.Is(err, ErrIdempotencyMismatch), errors.Is(err, ErrIdempotencyInProgress):
+        writeError(w, 409, CodeConflict, err.Error())
+    case errors.As(err, &conflict):
+        writeJSON(w, http.StatusConflict, map[string]any{
+            "error":   newErrorDetail(w, CodeConflict, conflict.Error()),
+            "current": conflict.Current,
+        })
+    default:
+        dbError(w, err)
+    }
+}
+
+// Page sizes used when Config.PageLimits has no entry for a resource.
+const (
+    defaultPageLimit = 50
+    maxPageLimit     = 200
+)
+
+// maxBatchIDs caps how many ids one ?ids= may list.
+const maxBatchIDs = 100
+
+// customerPage is the ListCustomers response envelope. Data holds the
+// []Customer, or its ?fields= projection.
+type customerPage struct {
+    XMLName    xml.Name `json:"-" xml:"customers"`
+    Data       any      `json:"data" xml:"customer"`
+    Limit      int      `json:"limit" xml:"limit"`
+    Offset     int      `json:"offset" xml:"offset"`
+    Total      int      `json:"total" xml:"total"`
+    MaxLimit   int      `json:"max_limit" xml:"max_limit"`
+    NextCursor string   `json:"next_cursor,omitempty" xml:"next_cursor,omitempty"`
 }
 
+// ListCustomers returns a page of customers, newest first. The page is chosen
+// with ?limit= (default and cap from Config.PageLimits, 50 and 200 unless
+// configured) and ?offset= (default 0); max_limit reports the cap.
+// ?q= filters to customers whose name or email contains the (case-insensitive)
+// search text, or whose phone contains its digits; an empty or
+// whitespace-only q returns the normal unfiltered list.
+// ?sort= orders by name, created_at or id, with a "-" prefix for descending;
+// the default is -id. Soft-deleted customers are hidden unless
+// ?include_deleted=true.
+//
+// ?ids=1,2,3 fetches those customers in one query, up to maxBatchIDs of
+// them; ids that don't exist are left out rather than failing the request.
+// Without ?limit= the page is then sized to fit them all, up to max_limit.
+//
+// Passing ?cursor= switches to keyset pagination on id, which stays fast and
+// consistent as rows are inserted: an empty cursor starts from the newest
+// customer, and each page's next_cursor fetches the one after it. Cursor mode
+// can't be combined with ?offset= or ?sort=. Cursors are signed (see
+// encodeCursor), so an altered or forged one gets a 400.
+//
+// ?fields=id,name limits each customer to the listed keys.
+//
+// ?envelope=false returns just the array of customers and ?envelope=true
+// nests the paging fields under "page"; see parsePageShape.
+//
+// The response is cacheable for Config.ListCacheMaxAge, with Last-Modified
+// from the newest listed row; see listCacheHeaders.
+//
+// The response is JSON, or XML when the Accept header asks for it.
 func (h *Handler) ListCustomers(w http.ResponseWriter, r *http.Request) {
-    rows, err := h.DB.Query(`SELECT id, name, email, created_at FROM customers ORDER BY id DESC LIMIT 200`)
+    mt, ok := negotiate(w, r)
+    if !ok {
+        return
+    }
+    pl := h.pageLimits("customers")
+    limit, offset, err := pl.parse(r)
+    if err != nil {
+        writeError(w, 400, CodeInvalidParameter, err.Error())
+        return
+    }
+
+    f, err := customerFilter(r)
+    if err != nil {
+        writeError(w, 400, CodeInvalidParameter, err.Error())
+        return
+    }
+    if len(f.IDs) > 0 && !r.URL.Query().Has("limit") {
+        limit = min(max(limit, len(f.IDs)), pl.Max)
+    }
+    f.Limit, f.Offset = limit, offset
+    fields, ok := customerFieldsFor(w, r, mt)
+    if !ok {
+        return
+    }
+    shape, err := parsePageShape(r)
+    if err != nil {
+        writeError(w, 400, CodeInvalidParameter, err.Error())
+        return
+    }
+    if shape != shapeFlat && mt != mediaJSON {
+        writeError(w, 400, CodeInvalidParameter, "envelope is only supported for JSON responses")
+        return
+    }
+
+    keyset := r.URL.Query().Has("cursor")
+    if keyset {
+        if r.URL.Query().Has("offset") || r.URL.Query().Has("sort") {
+            writeError(w, 400, CodeInvalidParameter, "cursor cannot be combined with offset or sort")
+            return
+        }
+        if token := r.URL.Query().Get("cursor"); token != "" {
+            cur, err := decodeCursor([]byte(h.Config.CursorSecret), token, keysetSort)
+            if err != nil {
+                writeError(w, 400, CodeInvalidParameter, err.Error())
+                return
+            }
+            f.BeforeID = cur.ID
+        }
+        // Fetch one extra row to learn whether a next page exists.
+        f.Limit++
+    }
+
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+
+    page := customerPage{Limit: limit, Offset: offset, MaxLimit: pl.Max}
+    // The count covers the whole filtered set; Count ignores the keyset bound.
+    if page.Total, err = h.Customers.Count(ctx, f); err != nil {
+        customerError(w, err)
+        return
+    }
+    customers, err := h.Customers.List(ctx, f)
+    if err != nil {
+        customerError(w, err)
+        return
+    }
+    if keyset && len(customers) > limit {
+        customers = customers[:limit]
+        page.NextCursor = encodeCursor([]byte(h.Config.CursorSecret), listCursor{ID: customers[limit-1].ID, Sort: keysetSort})
+    }
+    w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+    if h.listCacheHeaders(w, r, customersLastModified(customers)) {
+        return
+    }
+    if page.Data, err = selectFields(customers, fields); err != nil {
+        dbError(w, err)
+        return
+    }
+    respond(w, r, http.StatusOK, shapePage(shape, page, page.Data,
+        pl.meta(limit, offset, page.Total, page.NextCursor)))
+}
+
+// customerFieldsFor parses ?fields= for a response of type mt. Projections
+// are JSON objects, so they aren't offered in XML.
+func customerFieldsFor(w http.ResponseWriter, r *http.Request, mt string) ([]string, bool) {
+    fields, err := parseFields(r, customerFields)
+    if err != nil {
+        writeError(w, 400, CodeInvalidParameter, err.Error())
+        return nil, false
+    }
+    if fields != nil && mt != mediaJSON {
+        writeError(w, 400, CodeInvalidParameter, "fields is only supported for JSON responses")
+        return nil, false
+    }
+    return fields, true
+}
+
+// CountCustomers returns {"total": N} for the same filters ListCustomers
+// accepts, for "N matching customers" labels that don't need the rows.
+func (h *Handler) CountCustomers(w http.ResponseWriter, r *http.Request) {
+    total, ok := h.customerTotal(w, r)
+    if !ok {
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]int{"total": total})
+}
+
+// HeadCustomers answers HEAD /api/customers with the headers a GET would
+// carry for its count, X-Total-Count and Cache-Control, and no body, so
+// monitoring can read the total without the rows being fetched or sent.
+func (h *Handler) HeadCustomers(w http.ResponseWriter, r *http.Request) {
+    total, ok := h.customerTotal(w, r)
+    if !ok {
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("X-Total-Count", strconv.Itoa(total))
+    h.listCacheHeaders(w, r, time.Time{})
+    w.WriteHeader(http.StatusOK)
+}
+
+// customerTotal counts the customers matching the request's list filters.
+// On failure it has already written the error response.
+func (h *Handler) customerTotal(w http.ResponseWriter, r *http.Request) (int, bool) {
+    f, err := customerFilter(r)
+    if err != nil {
+        writeError(w, 400, CodeInvalidParameter, err.Error())
+        return 0, false
+    }
+
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+
+    total, err := h.Customers.Count(ctx, f)
+    if err != nil {
+        customerError(w, err)
+        return 0, false
+    }
+    return total, true
+}
+
+// customerFilter reads the list filters shared by ListCustomers,
+// CountCustomers, HeadCustomers and ExportCustomersCSV: ?q=, ?include_deleted=, ?sort=,
+// ?created_after= and ?created_before=.
+//
+// ?created_after= and ?created_before= take RFC3339 timestamps or YYYY-MM-DD
+// dates and bound created_at as [after, before); either may be used alone.
+func customerFilter(r *http.Request) (CustomerFilter, error) {
+    q := r.URL.Query()
+    f := CustomerFilter{
+        Query:          q.Get("q"),
+        IncludeDeleted: q.Get("include_deleted") == "true",
+        Sort:           q.Get("sort"),
+    }
+    if _, err := customerOrder(f.Sort); err != nil {
+        return f, err
+    }
+    if v := q.Get("ids"); v != "" {
+        ids, err := parseIDList(v)
+        if err != nil {
+            return f, err
+        }
+        f.IDs = ids
+    }
+    for _, b := range []struct {
+        param string
+        dst   **time.Time
+    }{
+        {"created_after", &f.CreatedAfter},
+        {"created_before", &f.CreatedBefore},
+    } {
+        v := q.Get(b.param)
+        if v == "" {
+            continue
+        }
+        t, err := parseTimeParam(v)
+        if err != nil {
+            return f, fmt.Errorf("%s must be an RFC3339 timestamp (2024-01-31T15:04:05Z) or a date (2024-01-31)", b.param)
+        }
+        *b.dst = &t
+    }
+    return f, nil
+}
+
+// parseIDList parses ?ids=, a comma-separated list of at most maxBatchIDs
+// positive integers; repeats are dropped.
+func parseIDList(v string) ([]int, error) {
+    parts := SplitList(v)
+    if len(parts) > maxBatchIDs {
+        return nil, fmt.Errorf("ids accepts at most %d ids", maxBatchIDs)
+    }
+    seen := map[int]bool{}
+    var ids []int
+    for _, p := range parts {
+        id, err := strconv.Atoi(p)
+        if err != nil || id <= 0 {
+            return nil, errors.New("ids must be a comma-separated list of positive integers")
+        }
+        if !seen[id] {
+            seen[id] = true
+            ids = append(ids, id)
+        }
+    }
+    return ids, nil
+}
+
+// parseTimeParam accepts an RFC3339 timestamp or a date-only value, the
+// latter meaning midnight UTC.
+func parseTimeParam(v string) (time.Time, error) {
+    if t, err := time.Parse(time.RFC3339, v); err == nil {
+        return t, nil
+    }
+    return time.Parse(time.DateOnly, v)
+}
+
+// GetCustomer returns one customer, as JSON or XML per Accept, with an ETag
+// derived from the rendered body; a request whose If-None-Match carries that
+// ETag gets 304 with no body. ?fields= works as in ListCustomers.
+func (h *Handler) GetCustomer(w http.ResponseWriter, r *http.Request) {
+    id, ok := customerID(w, r)
+    if !ok {
+        return
+    }
+    mt, ok := negotiate(w, r)
+    if !ok {
+        return
+    }
+    fields, ok := customerFieldsFor(w, r, mt)
+    if !ok {
+        return
+    }
+
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+    c, err := h.Customers.Get(ctx, id)
+    if err != nil {
+        customerError(w, err)
+        return
+    }
+    v, err := selectFields(c, fields)
+    if err != nil {
+        dbError(w, err)
+        return
+    }
+
+    body, err := encodeAs(w, mt, v)
+    if err != nil {
+        dbError(w, err)
+        return
+    }
+    etag := etagFor(body)
+    w.Header().Set("ETag", etag)
+    if etagMatches(r.Header.Get("If-None-Match"), etag) {
+        w.WriteHeader(http.StatusNotModified)
+        return
+    }
+    w.Header().Set("Content-Type", mt)
+    w.Write(body)
+}
+
+type CustomerInput struct {
+    Name  string  `json:"name" validate:"required,namelen"`
+    Email *string `json:"email" validate:"omitnil,emaillen,email"`
+    // Phone is stored in E.164 form, like +14155550123; see normalizePhone.
+    Phone *string `json:"phone" validate:"omitnil,phone"`
+}
+
+// normalize trims the input in place, shared by create and update so both
+// enforce the same rules.
+func (in *CustomerInput) normalize() {
+    in.Name = normalizeSpace(in.Name)
+    in.Email = trimEmail(in.Email)
+    in.Phone = normalizePhone(in.Phone)
+}
+
+// trimEmail trims and lowercases an optional email. Missing and empty values
+// both become nil (stored as NULL).
+func trimEmail(email *string) *string {
+    if email == nil {
+        return nil
+    }
+    e := strings.ToLower(strings.TrimSpace(*email))
+    if e == "" {
+        return nil
+    }
+    return &e
+}
+
+// phoneSeparators are the characters people write between a number's
+// digits, which E.164 leaves out.
+var phoneSeparators = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "", "/", "")
+
+// normalizePhone puts an optional phone number in E.164 form as far as it
+// can: separators are dropped and a leading 00 international prefix becomes
+// "+". Missing and empty values become nil. What is left is checked by the
+// phone tag, so a national number without its country code is rejected
+// rather than guessed at.
+func normalizePhone(phone *string) *string {
+    if phone == nil {
+        return nil
+    }
+    p := phoneSeparators.Replace(strings.TrimSpace(*phone))
+    if p == "" {
+        return nil
+    }
+    if rest, ok := strings.CutPrefix(p, "00"); ok {
+        p = "+" + rest
+    }
+    return &p
+}
+
+// CreateCustomer inserts a customer. With an Idempotency-Key header, a retry
+// carrying the same key and body within 24h gets the original response back
+// instead of creating a duplicate; the same key with a different body is 409.
+//
+// ?validate_only=true runs the insert, duplicate checks included, but rolls
+// it back, answering 200 {"validated": true, "customer": {...}} with no id.
+// The Idempotency-Key is ignored then.
+func (h *Handler) CreateCustomer(w http.ResponseWriter, r *http.Request) {
+    body, ok := readJSONBody(w, r, maxBodyBytes)
+    if !ok {
+        return
+    }
+    var in CustomerInput
+    if !unmarshalBody(w, body, &in) {
+        return
+    }
+    if err := checkPayload(&in); err != nil {
+        validationFailed(w, err)
+        return
+    }
+    var idem *IdempotencyKey
+    if key := r.Header.Get("Idempotency-Key"); key != "" {
+        if len(key) > maxIdempotencyKeyLen {
+            writeError(w, 400, CodeInvalidParameter, "Idempotency-Key is too long")
+            return
+        }
+        idem = &IdempotencyKey{Key: key, Hash: hashBody(body)}
+    }
+
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+
+    if validateOnly(r) {
+        if _, err := h.Customers.Create(withValidateOnly(ctx), in, nil); err != nil {
+            customerError(w, err)
+            return
+        }
+        writeJSON(w, http.StatusOK, map[string]any{"validated": true, "customer": in})
+        return
+    }
+
+    if idem != nil {
+        status, stored, err := h.Customers.Replay(ctx, *idem)
+        if err == nil {
+            w.Header().Set("Content-Type","application/json")
+            w.Header().Set("Idempotent-Replayed", "true")
+            if omitNulls(w) {
+                if b, err := dropNulls(stored); err == nil {
+                    stored = b
+                }
+            }
+            w.WriteHeader(status)
+            w.Write(stored)
+            return
+        }
+        if !errors.Is(err, ErrNotFound) {
+            customerError(w, err)
+            return
+        }
+    }
+
+    c, err := h.Customers.Create(ctx, in, idem)
+    if err != nil {
+        customerError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusCreated, c)
+}
+
+// customerUpdate is the PUT body: the full customer plus the version the
+// client last read.
+type customerUpdate struct {
+    CustomerInput
+    Version *int `json:"version" validate:"required"`
+}
+
+// UpdateCustomer replaces a customer's name, email and phone. Any id or timestamps
+// in the body are ignored; they are owned by the server. The body must carry
+// the version the client last read; if the row has moved on since, nothing
+// is written and a 409 returns the current state so the client can merge.
+func (h *Handler) UpdateCustomer(w http.ResponseWriter, r *http.Request) {
+    id, ok := customerID(w, r)
+    if !ok {
+        return
+    }
+
+    var in customerUpdate
+    if !decodeValid(w, r, &in) {
+        return
+    }
+
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+
+    c, err := h.Customers.Update(ctx, id, *in.Version, CustomerChanges{Name: &in.Name, SetEmail: true, Email: in.Email, SetPhone: true, Phone: in.Phone})
     if err != nil {
-        http.Error(w, err.Error(), 500)
+        customerError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, c)
+}
+
+// customerPatch holds the fields a PATCH may change; an absent field means
+// "leave as is". Version is the version the client last read and is required.
+type customerPatch struct {
+    Name    *string        `json:"name"`
+    Email   optionalString `json:"email"`
+    Phone   optionalString `json:"phone"`
+    Version *int           `json:"version"`
+}
+
+// patchFields carries CustomerInput's constraints for the fields a PATCH
+// sets; nil fields aren't being changed.
+type patchFields struct {
+    Name  *string `json:"name" validate:"omitnil,namelen"`
+    Email *string `json:"email" validate:"omitnil,emaillen,email"`
+    Phone *string `json:"phone" validate:"omitnil,phone"`
+}
+
+// PatchCustomer updates only the fields present in the body. An email or
+// phone of null or "" clears the column; leaving the key out keeps it.
+func (h *Handler) PatchCustomer(w http.ResponseWriter, r *http.Request) {
+    id, ok := customerID(w, r)
+    if !ok {
         return
     }
-    defer rows.Close()
 
-    out := []Customer{}
-    for rows.Next() {
-        var c Customer
-        if err := rows.Scan(&c.ID, &c.Name, &c.Email, &c.CreatedAt); err != nil {
-            http.Error(w, err.Error(), 500)
+    var in customerPatch
+    if !decodeJSON(w, r, &in) {
+        return
+    }
+
+    var ch CustomerChanges
+    if in.Name != nil {
+        name := normalizeSpace(*in.Name)
+        if name == "" {
+            writeError(w, 400, CodeValidationFailed, "name must not be empty")
             return
         }
-        out = append(out, c)
+        ch.Name = &name
+    }
+    if in.Email.Set {
+        ch.SetEmail, ch.Email = true, trimEmail(in.Email.Value)
+    }
+    if in.Phone.Set {
+        ch.SetPhone, ch.Phone = true, normalizePhone(in.Phone.Value)
+    }
+    if err := validateStruct(patchFields{Name: ch.Name, Email: ch.Email, Phone: ch.Phone}); err != nil {
+        validationFailed(w, err)
+        return
+    }
+    if ch.Name == nil && !ch.SetEmail && !ch.SetPhone {
+        writeError(w, 400, CodeValidationFailed, "no updatable fields provided")
+        return
     }
+    if in.Version == nil {
+        writeError(w, 400, CodeValidationFailed, "version is required")
+        return
+    }
+
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+
+    c, err := h.Customers.Update(ctx, id, *in.Version, ch)
+    if err != nil {
+        customerError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, c)
+}
+
+// DeleteCustomer soft-deletes a customer by stamping deleted_at, keeping the
+// row for audits. RestoreCustomer undoes it. With an If-Unmodified-Since
+// header, a customer updated after that time is not deleted and the answer
+// is 412; an unparseable date is ignored, as RFC 9110 requires.
+func (h *Handler) DeleteCustomer(w http.ResponseWriter, r *http.Request) {
+    id, ok := customerID(w, r)
+    if !ok {
+        return
+    }
+    var since time.Time
+    if v := r.Header.Get("If-Unmodified-Since"); v != "" {
+        if t, err := http.ParseTime(v); err == nil {
+            since = t
+        }
+    }
+
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+
+    if err := h.Customers.Delete(ctx, id, since); err != nil {
+        customerError(w, err)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// RestoreCustomer clears deleted_at on a soft-deleted customer and returns it.
+func (h *Handler) RestoreCustomer(w http.ResponseWriter, r *http.Request) {
+    id, ok := customerID(w, r)
+    if !ok {
+        return
+    }
+
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+
+    c, err := h.Customers.Restore(ctx, id)
+    if errors.Is(err, ErrNotFound) {
+        writeError(w, 404, CodeNotFound, "no deleted customer with that id")
+        return
+    }
+    if err != nil {
+        customerError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, c)
+}
+
+// mergeInput is the POST /api/customers/{id}/merge body.
+type mergeInput struct {
+    SourceID int `json:"source_id" validate:"required"`
+}
+
+// MergeCustomer folds the customer named by source_id into {id}: the
+// source's cases move to {id}, fields {id} lacks are copied from the source,
+// and the source is soft-deleted, in one transaction. It returns the merged
+// customer. Merging a customer into itself is a 400; either side being
+// soft-deleted is a 409.
+func (h *Handler) MergeCustomer(w http.ResponseWriter, r *http.Request) {
+    id, ok := customerID(w, r)
+    if !ok {
+        return
+    }
+
+    var in mergeInput
+    if !decodeValid(w, r, &in) {
+        return
+    }
+    if in.SourceID == id {
+        writeError(w, 400, CodeValidationFailed, "cannot merge a customer into itself")
+        return
+    }
+
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+
+    c, err := h.Customers.Merge(ctx, id, in.SourceID)
+    if errors.Is(err, ErrMergeDeleted) {
+        writeError(w, 409, CodeConflict, err.Error())
+        return
+    }
+    if err != nil {
+        customerError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, c)
+}
+
+const (
+    // maxBulkRows caps how many customers one bulk request may create.
+    maxBulkRows = 1000
+    // maxBulkBodyBytes is the body limit for bulk requests, sized for
+    // maxBulkRows typical rows.
+    maxBulkBodyBytes = 8 << 20
+)
+
+// bulkResult reports the outcome for one row of a bulk request, identified by
+// its position in the request array. Status is "created", "invalid",
+// "skipped" (valid, but not inserted because another row failed), or "valid"
+// under ?validate_only=true.
+type bulkResult struct {
+    Index  int    `json:"index"`
+    Status string `json:"status"`
+    ID     int    `json:"id,omitempty"`
+    Error  string `json:"error,omitempty"`
+}
+
+// BulkCreateCustomers inserts an array of customers atomically. Every row is
+// validated first; if any row is invalid nothing is inserted and the
+// per-row results are returned with a 400. Otherwise all rows are inserted in
+// one transaction, which is rolled back on the first database error.
+// ?validate_only=true works as in CreateCustomer.
+func (h *Handler) BulkCreateCustomers(w http.ResponseWriter, r *http.Request) {
+    var in []CustomerInput
+    if !decodeJSONLimit(w, r, &in, maxBulkBodyBytes) {
+        return
+    }
+    if len(in) == 0 {
+        writeError(w, 400, CodeValidationFailed, "at least one customer is required")
+        return
+    }
+    if len(in) > maxBulkRows {
+        writeError(w, http.StatusRequestEntityTooLarge, CodeTooLarge, fmt.Sprintf("at most %d customers may be created per request", maxBulkRows))
+        return
+    }
+
+    results := make([]bulkResult, len(in))
+    invalid := false
+    for i := range in {
+        results[i] = bulkResult{Index: i, Status: "skipped"}
+        if err := checkPayload(&in[i]); err != nil {
+            results[i].Status, results[i].Error = "invalid", err.Error()
+            invalid = true
+        }
+    }
+    if invalid {
+        writeJSON(w, http.StatusBadRequest, map[string]any{"results": results})
+        return
+    }
+
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+
+    if validateOnly(r) {
+        if _, err := h.Customers.BulkCreate(withValidateOnly(ctx), in); err != nil {
+            customerError(w, err)
+            return
+        }
+        for i := range results {
+            results[i].Status = "valid"
+        }
+        writeJSON(w, http.StatusOK, map[string]any{"validated": true, "results": results})
+        return
+    }
+
+    created, err := h.Customers.BulkCreate(ctx, in)
+    if err != nil {
+        customerError(w, err)
+        return
+    }
+    for i, c := range created {
+        results[i].Status, results[i].ID = "created", c.ID
+    }
+    writeJSON(w, http.StatusCreated, map[string]any{"results": results})
+}
+
+// validateOnly reports whether the request asked for ?validate_only=true.
+func validateOnly(r *http.Request) bool {
+    return r.URL.Query().Get("validate_only") == "true"
+}
+
+// queryInt reads a non-negative integer query parameter, returning def when
+// the parameter is absent.
+func queryInt(r *http.Request, key string, def int) (int, error) {
+    v := r.URL.Query().Get(key)
+    if v == "" {
+        return def, nil
+    }
+    n, err := strconv.Atoi(v)
+    if err != nil || n < 0 {
+        return 0, fmt.Errorf("%s must be a non-negative integer", key)
+    }
+    return n, nil
+}
+
+// customerID parses the {id} route variable, writing a 400 when it isn't numeric.
+func customerID(w http.ResponseWriter, r *http.Request) (int, bool) {
+    id, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        writeError(w, 400, CodeInvalidParameter, "invalid customer id")
+        return 0, false
+    }
+    return id, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
     w.Header().Set("Content-Type","application/json")
-    json.NewEncoder(w).Encode(out)
-}
\ No newline at end of file
+    if omitNulls(w) {
+        var buf bytes.Buffer
+        json.NewEncoder(&buf).Encode(v)
+        if b, err := dropNulls(buf.Bytes()); err == nil {
+            w.WriteHeader(status)
+            w.Write(b)
+            return
+        }
+    }
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(v)
+}
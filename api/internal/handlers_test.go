@@ -0,0 +1,147 @@
+package internal
+
+import (
+    "context"
+    "database/sql"
+    "database/sql/driver"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gorilla/mux"
+)
+
+// testCursorSecret signs the cursors of test handlers.
+const testCursorSecret = "test-cursor-secret"
+
+// newTestHandler returns a Handler over db, with the real CustomerRepo and
+// the config defaults the handlers need.
+func newTestHandler(t *testing.T, db *sql.DB) *Handler {
+    t.Helper()
+    repo, err := NewCustomerRepo(context.Background(), db, nil, 1)
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { repo.Close() })
+    cfg := &Config{
+        QueryTimeout:  5 * time.Second,
+        DBTxAttempts:  1,
+        CursorSecret:  testCursorSecret,
+        StatsCacheTTL: time.Minute,
+    }
+    return &Handler{DB: db, Config: cfg, Customers: repo, Maintenance: NewMaintenance(false)}
+}
+
+// serve routes req to fn registered at pattern, so route variables are set
+// as they are in main.
+func serve(pattern string, fn http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+    r := mux.NewRouter()
+    r.HandleFunc(pattern, fn)
+    rec := httptest.NewRecorder()
+    r.ServeHTTP(rec, req)
+    return rec
+}
+
+// jsonRequest is a request with body sent as application/json.
+func jsonRequest(method, target, body string) *http.Request {
+    req := httptest.NewRequest(method, target, strings.NewReader(body))
+    req.Header.Set("Content-Type", "application/json")
+    return req
+}
+
+// customerRow is a customers row in customerColumns order.
+func customerRow(id int64, name string, email any, version int64) []driver.Value {
+    now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+    return []driver.Value{id, name, email, nil, version, now, now, nil}
+}
+
+// stubCustomers is a CustomerStore holding customers in memory, for handler
+// tests that aren't about SQL. It records the filters it was given; methods
+// it doesn't implement panic through the nil embedded interface.
+type stubCustomers struct {
+    CustomerStore
+    customers []Customer
+    filters   []CustomerFilter
+}
+
+func (s *stubCustomers) List(_ context.Context, f CustomerFilter) ([]Customer, error) {
+    s.filters = append(s.filters, f)
+    var out []Customer
+    for _, c := range s.customers {
+        if f.BeforeID == 0 || c.ID < f.BeforeID {
+            out = append(out, c)
+        }
+    }
+    return out[:min(len(out), f.Limit)], nil
+}
+
+func (s *stubCustomers) Count(_ context.Context, f CustomerFilter) (int, error) {
+    s.filters = append(s.filters, f)
+    return len(s.customers), nil
+}
+
+// newStubHandler returns a Handler whose CustomerStore serves customers,
+// newest (highest ID) first as the repo does.
+func newStubHandler(customers ...Customer) (*Handler, *stubCustomers) {
+    store := &stubCustomers{customers: customers}
+    cfg := &Config{QueryTimeout: 5 * time.Second, CursorSecret: testCursorSecret}
+    return &Handler{Config: cfg, Customers: store}, store
+}
+
+// testCustomers returns n customers with IDs n down to 1.
+func testCustomers(n int) []Customer {
+    now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+    out := make([]Customer, n)
+    for i := range out {
+        id := n - i
+        out[i] = Customer{ID: id, Name: "Customer " + strconv.Itoa(id), Version: 1, CreatedAt: &now, UpdatedAt: &now}
+    }
+    return out
+}
+
+func TestPatchCustomerEmail(t *testing.T) {
+    for _, tc := range []struct {
+        name, body string
+        sets       string
+        args       []driver.Value
+    }{
+        {"present", `{"version": 3, "email": " Ada@Example.com "}`, "email = ?, version = version + 1", []driver.Value{"ada@example.com", int64(41)}},
+        {"null", `{"version": 3, "email": null}`, "email = ?, version = version + 1", []driver.Value{nil, int64(41)}},
+        {"empty", `{"version": 3, "email": ""}`, "email = ?, version = version + 1", []driver.Value{nil, int64(41)}},
+        {"absent", `{"version": 3, "name": "Ada L"}`, "name = ?, version = version + 1", []driver.Value{"Ada L", int64(41)}},
+    } {
+        db, fake := newFakeDB(t, func(query string, args []driver.Value) fakeResult {
+            if strings.HasPrefix(query, "SELECT "+customerColumns+" FROM customers") {
+                return fakeResult{rows: [][]driver.Value{customerRow(41, "Ada", "ada@old.example.com", 3)}}
+            }
+            return fakeResult{affected: 1}
+        })
+        h := newTestHandler(t, db)
+
+        rec := serve("/api/customers/{id}", h.PatchCustomer, jsonRequest("PATCH", "/api/customers/41", tc.body))
+        if rec.Code != http.StatusOK {
+            t.Errorf("%s: status %d: %s", tc.name, rec.Code, rec.Body)
+            continue
+        }
+        var updates []fakeStatement
+        for _, st := range fake.Statements() {
+            if strings.HasPrefix(st.Query, "UPDATE customers") {
+                updates = append(updates, st)
+            }
+        }
+        if len(updates) != 1 {
+            t.Errorf("%s: %d UPDATEs, want 1", tc.name, len(updates))
+            continue
+        }
+        if want := "UPDATE customers SET " + tc.sets + " WHERE id = ?"; updates[0].Query != want {
+            t.Errorf("%s: ran %q, want %q", tc.name, updates[0].Query, want)
+        }
+        if !reflect.DeepEqual(updates[0].Args, tc.args) {
+            t.Errorf("%s: args %#v, want %#v", tc.name, updates[0].Args, tc.args)
+        }
+    }
+}
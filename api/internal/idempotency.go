@@ -0,0 +1,38 @@
+package internal
+
+import (
+    "context"
+    "crypto/sha256"
+    "database/sql"
+    "encoding/hex"
+    "errors"
+)
+
+const (
+    // idempotencyWindow is how long, in seconds, a stored response is
+    // replayed for its key.
+    idempotencyWindow    = 24 * 60 * 60
+    maxIdempotencyKeyLen = 255
+)
+
+// ErrIdempotencyMismatch means a key was reused with a different body.
+var ErrIdempotencyMismatch = errors.New("idempotency key was already used with a different request body")
+
+func hashBody(body []byte) string {
+    sum := sha256.Sum256(body)
+    return hex.EncodeToString(sum[:])
+}
+
+// saveIdempotent records the response for key inside tx, so it commits or
+// rolls back together with the write it describes. An expired entry for the
+// same key is replaced.
+func saveIdempotent(ctx context.Context, tx *sql.Tx, key, hash string, status int, body []byte) error {
+    org := orgFromContext(ctx)
+    if _, err := tx.ExecContext(ctx, `DELETE FROM idempotency_keys
+        WHERE org_id = ? AND idem_key = ? AND created_at <= `+dialect.secondsAgo(), org, key, idempotencyWindow); err != nil {
+        return err
+    }
+    _, err := tx.ExecContext(ctx, `INSERT INTO idempotency_keys (org_id, idem_key, request_hash, status_code, response_body)
+        VALUES (?, ?, ?, ?, ?)`, org, key, hash, status, body)
+    return err
+}
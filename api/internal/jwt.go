@@ -0,0 +1,269 @@
+package internal
+
+import (
+    "context"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rsa"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math/big"
+    "net/http"
+    "slices"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+    "unicode/utf8"
+
+    "github.com/golang-jwt/jwt/v5"
+)
+
+const (
+    // jwksTTL is how long fetched signing keys are trusted before the JWKS
+    // is fetched again.
+    jwksTTL = time.Hour
+    // jwksMinRefresh stops a stream of tokens with unknown key ids from
+    // fetching the JWKS on every request.
+    jwksMinRefresh = time.Minute
+)
+
+// JWTAuth authenticates bearer JWTs signed either with a shared secret
+// (HS256/384/512) or with a key published at a JWKS URL (RS* and ES*). A
+// token must carry exp, and iss and aud when those are configured.
+type JWTAuth struct {
+    secret     []byte
+    jwksURL    string
+    orgClaim   string
+    // A token is an admin when its rolesClaim claim includes adminRole.
+    rolesClaim string
+    adminRole  string
+    opts       []jwt.ParserOption
+    client     *http.Client
+
+    mu      sync.Mutex
+    keys    map[string]any // kid -> *rsa.PublicKey or *ecdsa.PublicKey
+    fetched time.Time
+}
+
+// NewJWTAuth returns a JWTAuth for cfg's JWT settings, or nil when neither
+// JWT_SECRET nor JWT_JWKS_URL is set.
+func NewJWTAuth(cfg *Config) *JWTAuth {
+    if cfg.JWTSecret == "" && cfg.JWTJWKSURL == "" {
+        return nil
+    }
+    var methods []string
+    if cfg.JWTSecret != "" {
+        methods = append(methods, "HS256", "HS384", "HS512")
+    }
+    if cfg.JWTJWKSURL != "" {
+        methods = append(methods, "RS256", "RS384", "RS512", "ES256", "ES384", "ES512")
+    }
+    opts := []jwt.ParserOption{jwt.WithValidMethods(methods), jwt.WithExpirationRequired(), jwt.WithLeeway(30 * time.Second)}
+    if cfg.JWTIssuer != "" {
+        opts = append(opts, jwt.WithIssuer(cfg.JWTIssuer))
+    }
+    if cfg.JWTAudience != "" {
+        opts = append(opts, jwt.WithAudience(cfg.JWTAudience))
+    }
+    return &JWTAuth{
+        secret:     []byte(cfg.JWTSecret),
+        jwksURL:    cfg.JWTJWKSURL,
+        orgClaim:   cfg.JWTOrgClaim,
+        rolesClaim: cfg.JWTRolesClaim,
+        adminRole:  cfg.JWTAdminRole,
+        opts:       opts,
+        client:     &http.Client{Timeout: 5 * time.Second},
+    }
+}
+
+// Authenticate verifies token's signature and claims and returns its
+// subject as the principal, in the org named by the org claim: a positive
+// integer, as a number or a string. A token without the claim is in
+// defaultOrgID; one with a malformed claim is rejected. The token is an
+// admin when its roles claim includes the admin role.
+func (a *JWTAuth) Authenticate(ctx context.Context, token string) (User, error) {
+    claims := jwt.MapClaims{}
+    _, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+        if _, ok := t.Method.(*jwt.SigningMethodHMAC); ok {
+            return a.secret, nil
+        }
+        kid, _ := t.Header["kid"].(string)
+        return a.key(ctx, kid)
+    }, a.opts...)
+    if errors.Is(err, jwt.ErrTokenExpired) {
+        return User{}, errTokenExpired
+    }
+    if err != nil {
+        return User{}, errBadCredentials
+    }
+    sub, _ := claims.GetSubject()
+    id := "user:" + sub
+    // The ID is recorded as the actor of the caller's writes, so it must fit
+    // those columns.
+    if sub == "" || utf8.RuneCountInString(id) > maxActorLen {
+        return User{}, errBadCredentials
+    }
+    org, ok := claimOrg(claims[a.orgClaim])
+    if !ok {
+        return User{}, errBadCredentials
+    }
+    admin := a.adminRole != "" && claimHasRole(claims[a.rolesClaim], a.adminRole)
+    return User{ID: id, OrgID: org, Admin: admin, Subject: sub, Claims: claims}, nil
+}
+
+// claimHasRole reports whether a roles claim, an array of strings or a
+// space-separated string as in the scope claim, includes role.
+func claimHasRole(v any, role string) bool {
+    switch v := v.(type) {
+    case string:
+        return slices.Contains(strings.Fields(v), role)
+    case []any:
+        for _, r := range v {
+            if r == role {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// claimOrg reads an org claim; a missing claim is org 0 (the default).
+func claimOrg(v any) (int, bool) {
+    switch v := v.(type) {
+    case nil:
+        return 0, true
+    case float64:
+        if v > 0 && v == float64(int(v)) {
+            return int(v), true
+        }
+    case string:
+        if n, err := strconv.Atoi(v); err == nil && n > 0 {
+            return n, true
+        }
+    }
+    return 0, false
+}
+
+// key returns the JWKS key with id kid, refetching the set when it is stale
+// or doesn't have kid, at most once per jwksMinRefresh.
+func (a *JWTAuth) key(ctx context.Context, kid string) (any, error) {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+
+    k, ok := a.keys[kid]
+    stale := time.Since(a.fetched) > jwksTTL
+    if ok && !stale {
+        return k, nil
+    }
+    if stale || time.Since(a.fetched) > jwksMinRefresh {
+        keys, err := a.fetchJWKS(ctx)
+        if err != nil {
+            // Keep serving the keys we have if the JWKS endpoint is down.
+            if ok {
+                return k, nil
+            }
+            return nil, err
+        }
+        a.keys, a.fetched = keys, time.Now()
+        if k, ok := keys[kid]; ok {
+            return k, nil
+        }
+    }
+    return nil, fmt.Errorf("no signing key with kid %q", kid)
+}
+
+// jwk is the subset of an RFC 7517 JSON Web Key that JWTAuth uses.
+type jwk struct {
+    Kty string `json:"kty"`
+    Kid string `json:"kid"`
+    Use string `json:"use"`
+    N   string `json:"n"`
+    E   string `json:"e"`
+    Crv string `json:"crv"`
+    X   string `json:"x"`
+    Y   string `json:"y"`
+}
+
+// fetchJWKS downloads the key set, skipping keys that aren't for signatures
+// or whose type isn't supported.
+func (a *JWTAuth) fetchJWKS(ctx context.Context) (map[string]any, error) {
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.jwksURL, nil)
+    if err != nil {
+        return nil, err
+    }
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("fetch JWKS: %w", err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("fetch JWKS: %s", resp.Status)
+    }
+    var set struct {
+        Keys []jwk `json:"keys"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+        return nil, fmt.Errorf("decode JWKS: %w", err)
+    }
+
+    keys := map[string]any{}
+    for _, k := range set.Keys {
+        if k.Use != "" && k.Use != "sig" {
+            continue
+        }
+        if pub, err := k.publicKey(); err == nil {
+            keys[k.Kid] = pub
+        }
+    }
+    return keys, nil
+}
+
+func (k jwk) publicKey() (any, error) {
+    switch k.Kty {
+    case "RSA":
+        n, err := b64Int(k.N)
+        if err != nil {
+            return nil, err
+        }
+        e, err := b64Int(k.E)
+        if err != nil {
+            return nil, err
+        }
+        return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+    case "EC":
+        var curve elliptic.Curve
+        switch k.Crv {
+        case "P-256":
+            curve = elliptic.P256()
+        case "P-384":
+            curve = elliptic.P384()
+        case "P-521":
+            curve = elliptic.P521()
+        default:
+            return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+        }
+        x, err := b64Int(k.X)
+        if err != nil {
+            return nil, err
+        }
+        y, err := b64Int(k.Y)
+        if err != nil {
+            return nil, err
+        }
+        return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+    }
+    return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// b64Int decodes a base64url big-endian unsigned integer, as JWKs encode
+// key parameters.
+func b64Int(s string) (*big.Int, error) {
+    b, err := base64.RawURLEncoding.DecodeString(s)
+    if err != nil {
+        return nil, err
+    }
+    return new(big.Int).SetBytes(b), nil
+}
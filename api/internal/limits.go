@@ -0,0 +1,35 @@
+package internal
+
+// Field length limits, in characters rather than bytes so multi-byte text
+// isn't over-counted. They sit at or below the column sizes, so a value that
+// passes is never truncated by the database.
+const (
+    maxNameLen  = 200
+    maxEmailLen = 320
+    maxTitleLen = 255
+
+    maxAssigneeLen = 255
+    maxCommentLen  = 10000
+
+    maxFilenameLen    = 255
+    maxContentTypeLen = 255
+    maxURLLen         = 2048
+
+    // maxActorLen is the width of audit_log.actor and case_comments.author,
+    // which hold a principal's User.ID.
+    maxActorLen = 255
+)
+
+// lengthTags name the limits above for validate tags: a payload declares
+// `validate:"required,titlelen"` rather than repeating max=255, so each
+// limit, and the maxLength the OpenAPI document gives it, is set here only.
+var lengthTags = map[string]int{
+    "namelen":        maxNameLen,
+    "emaillen":       maxEmailLen,
+    "titlelen":       maxTitleLen,
+    "assigneelen":    maxAssigneeLen,
+    "commentlen":     maxCommentLen,
+    "filenamelen":    maxFilenameLen,
+    "contenttypelen": maxContentTypeLen,
+    "urllen":         maxURLLen,
+}
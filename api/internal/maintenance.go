@@ -0,0 +1,71 @@
+package internal
+
+import (
+    "net/http"
+    "strconv"
+    "sync/atomic"
+)
+
+// maintenanceRetryAfter is the Retry-After, in seconds, on writes refused
+// during maintenance.
+const maintenanceRetryAfter = 60
+
+// maintenancePath toggles the mode, so it stays writable while it is on.
+const maintenancePath = "/api/admin/maintenance"
+
+// Maintenance is the process-wide maintenance flag. While it is on, Guard
+// refuses every mutating request and reads carry on as usual.
+type Maintenance struct {
+    on atomic.Bool
+}
+
+// NewMaintenance returns a flag starting in the given state
+// (MAINTENANCE_MODE).
+func NewMaintenance(on bool) *Maintenance {
+    m := &Maintenance{}
+    m.on.Store(on)
+    return m
+}
+
+// Enabled reports whether maintenance mode is on. A nil Maintenance is off.
+func (m *Maintenance) Enabled() bool {
+    return m != nil && m.on.Load()
+}
+
+// Guard answers POST, PUT, PATCH and DELETE requests with 503 and a
+// Retry-After header while maintenance mode is on, except for the toggle
+// itself.
+func (m *Maintenance) Guard(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch r.Method {
+        case http.MethodGet, http.MethodHead, http.MethodOptions:
+        default:
+            if m.Enabled() && r.URL.Path != maintenancePath {
+                w.Header().Set("Retry-After", strconv.Itoa(maintenanceRetryAfter))
+                writeError(w, http.StatusServiceUnavailable, CodeMaintenance, "the service is in maintenance mode; writes are disabled")
+                return
+            }
+        }
+        next.ServeHTTP(w, r)
+    })
+}
+
+// GetMaintenance reports whether maintenance mode is on.
+func (h *Handler) GetMaintenance(w http.ResponseWriter, r *http.Request) {
+    writeJSON(w, http.StatusOK, map[string]bool{"enabled": h.Maintenance.Enabled()})
+}
+
+// SetMaintenance turns maintenance mode on or off from {"enabled": bool}.
+// The change is logged with the caller's identity and lasts until the next
+// change or restart, when MAINTENANCE_MODE applies again.
+func (h *Handler) SetMaintenance(w http.ResponseWriter, r *http.Request) {
+    var in struct {
+        Enabled *bool `json:"enabled" validate:"required"`
+    }
+    if !decodeValid(w, r, &in) {
+        return
+    }
+    h.Maintenance.on.Store(*in.Enabled)
+    logRequest(RequestIDFromContext(r.Context()), "maintenance mode set to %t by %s", *in.Enabled, actorFromContext(r.Context()))
+    writeJSON(w, http.StatusOK, map[string]bool{"enabled": *in.Enabled})
+}
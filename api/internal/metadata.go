@@ -0,0 +1,73 @@
+package internal
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "net/url"
+    "regexp"
+    "sort"
+    "strings"
+)
+
+// maxCaseMetadataBytes caps a case's metadata object, well inside the JSON
+// column it is stored in.
+const maxCaseMetadataBytes = 16 << 10
+
+// metaParamPrefix marks a list query parameter as a metadata filter:
+// ?meta.team=billing keeps cases whose metadata has "team": "billing".
+const metaParamPrefix = "meta."
+
+// metaKeyPattern is what a filterable metadata key may look like. Keys are
+// spliced into a JSON path on MySQL, so anything that would need quoting is
+// refused rather than escaped.
+var metaKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// normalizeMetadata trims a metadata value as decoded, turning an explicit
+// null into nil, which stores NULL.
+func normalizeMetadata(m json.RawMessage) json.RawMessage {
+    m = bytes.TrimSpace(m)
+    if len(m) == 0 || string(m) == "null" {
+        return nil
+    }
+    return m
+}
+
+// isMetadataObject reports whether m is a JSON object within
+// maxCaseMetadataBytes; the jsonobject tag checks it. m has already been
+// decoded, so it is valid JSON and only its kind needs looking at.
+func isMetadataObject(m []byte) bool {
+    return len(m) <= maxCaseMetadataBytes && len(m) > 0 && m[0] == '{'
+}
+
+// metadataArg is the column value for m: its text, or NULL for none.
+func metadataArg(m json.RawMessage) any {
+    if m == nil {
+        return nil
+    }
+    return string(m)
+}
+
+// metadataFilter turns the ?meta.<key>=<value> parameters in q into
+// predicates matching cases whose metadata has that top-level key with that
+// value, compared as text: ?meta.count=3 matches both 3 and "3". Several
+// keys must all match.
+func metadataFilter(q url.Values) ([]string, []any, error) {
+    var keys []string
+    for param := range q {
+        if key, ok := strings.CutPrefix(param, metaParamPrefix); ok {
+            if !metaKeyPattern.MatchString(key) {
+                return nil, nil, fmt.Errorf("%s: metadata keys are 1 to 64 letters, digits, _ or -", param)
+            }
+            keys = append(keys, key)
+        }
+    }
+    sort.Strings(keys)
+    var preds []string
+    var args []any
+    for _, key := range keys {
+        preds = append(preds, dialect.jsonKey("metadata")+" = ?")
+        args = append(args, key, q.Get(metaParamPrefix+key))
+    }
+    return preds, args, nil
+}
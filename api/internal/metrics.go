@@ -0,0 +1,69 @@
+package internal
+
+import (
+    "database/sql"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gorilla/mux"
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/collectors"
+    "github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+    httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+        Name: "http_requests_total",
+        Help: "HTTP requests served, by method, route template and status.",
+    }, []string{"method", "route", "status"})
+
+    httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+        Name:    "http_request_duration_seconds",
+        Help:    "HTTP request latency, by method and route template.",
+        Buckets: prometheus.DefBuckets,
+    }, []string{"method", "route"})
+
+    concurrencyRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+        Name: "http_concurrency_rejected_total",
+        Help: "Requests refused with 429 by LimitConcurrency, by route template.",
+    }, []string{"route"})
+)
+
+// RegisterDBMetrics exposes the connection pool stats (open, in-use, idle,
+// waits) of db as go_sql_* gauges.
+func RegisterDBMetrics(db *sql.DB, name string) {
+    prometheus.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// Instrument records request counts and latencies for every request passing
+// through it. The route label is the mux route template (e.g.
+// /api/customers/{id}) rather than the raw path, keeping label cardinality
+// bounded; requests that match no route are labeled "unmatched".
+func Instrument(next http.Handler, router *mux.Router) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        route := routeTemplate(router, r)
+
+        start := time.Now()
+        rw := &responseWriter{ResponseWriter: w}
+        next.ServeHTTP(rw, r)
+        if rw.status == 0 {
+            rw.status = http.StatusOK
+        }
+
+        httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(rw.status)).Inc()
+        httpDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+    })
+}
+
+// routeTemplate returns the template of the route r matches, or
+// "unmatched".
+func routeTemplate(router *mux.Router, r *http.Request) string {
+    var match mux.RouteMatch
+    if router.Match(r, &match) && match.Route != nil {
+        if tpl, err := match.Route.GetPathTemplate(); err == nil {
+            return tpl
+        }
+    }
+    return "unmatched"
+}
@@ -0,0 +1,114 @@
+package internal
+
+import (
+    "encoding/json"
+    "log"
+    "net/http"
+    "runtime/debug"
+    "strings"
+    "time"
+
+    "github.com/gorilla/mux"
+)
+
+// responseWriter records the status code and body size written by a handler.
+type responseWriter struct {
+    http.ResponseWriter
+    status int
+    bytes  int
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+    if rw.status == 0 {
+        rw.status = status
+    }
+    rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+    if rw.status == 0 {
+        rw.status = http.StatusOK
+    }
+    n, err := rw.ResponseWriter.Write(b)
+    rw.bytes += n
+    return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+    return rw.ResponseWriter
+}
+
+// LogRequests logs one line per request with its method, path, status,
+// response size and duration. format "json" emits a JSON object per line;
+// anything else emits a human-readable line.
+func LogRequests(next http.Handler, format string) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        start := time.Now()
+        rw := &responseWriter{ResponseWriter: w}
+        next.ServeHTTP(rw, r)
+        if rw.status == 0 {
+            rw.status = http.StatusOK
+        }
+        dur := time.Since(start)
+
+        if format == "json" {
+            line, _ := json.Marshal(map[string]any{
+                "request_id":  RequestIDFromContext(r.Context()),
+                "method":      r.Method,
+                "path":        r.URL.Path,
+                "status":      rw.status,
+                "bytes":       rw.bytes,
+                "duration_ms": float64(dur.Microseconds()) / 1000,
+            })
+            log.Print(string(line))
+            return
+        }
+        logRequest(RequestIDFromContext(r.Context()), "%s %s %d %dB %s", r.Method, r.URL.Path, rw.status, rw.bytes, dur)
+    })
+}
+
+// routeMethods are the methods probed when building an Allow header.
+var routeMethods = []string{
+    http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+    http.MethodPatch, http.MethodDelete,
+}
+
+// MethodNotAllowed answers requests whose path matches a route of router but
+// whose method doesn't, with a 405 and an Allow header listing the methods
+// registered for that path. Set it as router.MethodNotAllowedHandler.
+func MethodNotAllowed(router *mux.Router) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        var allow []string
+        for _, m := range routeMethods {
+            probe := r.Clone(r.Context())
+            probe.Method = m
+            // Match also reports true for a method mismatch once a
+            // MethodNotAllowedHandler is set, so check MatchErr as well.
+            var match mux.RouteMatch
+            if router.Match(probe, &match) && match.MatchErr == nil {
+                allow = append(allow, m)
+            }
+        }
+        w.Header().Set("Allow", strings.Join(allow, ", "))
+        writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path)
+    })
+}
+
+// Recover turns a panic in next into a logged stack trace and a 500 JSON
+// error, so one bad request can't take down the process.
+func Recover(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        defer func() {
+            if v := recover(); v != nil {
+                if v == http.ErrAbortHandler {
+                    // Deliberate abort: let net/http handle it as usual.
+                    panic(v)
+                }
+                logRequest(RequestIDFromContext(r.Context()), "panic serving %s %s: %v\n%s", r.Method, r.URL.Path, v, debug.Stack())
+                writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+            }
+        }()
+        next.ServeHTTP(w, r)
+    })
+}
@@ -0,0 +1,106 @@
+package internal
+
+import (
+    "encoding/json"
+    "io"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gorilla/mux"
+)
+
+// errorCode decodes the code of an error response body.
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) ErrorCode {
+    t.Helper()
+    var body errorBody
+    if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+        t.Fatalf("error body %q: %v", rec.Body.String(), err)
+    }
+    return body.Error.Code
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+    h := &Handler{}
+    r := mux.NewRouter()
+    r.HandleFunc("/api/health", h.Health).Methods("GET")
+    r.HandleFunc("/api/customers", h.ListCustomers).Methods("GET")
+    r.HandleFunc("/api/customers", h.CreateCustomer).Methods("POST")
+    r.MethodNotAllowedHandler = MethodNotAllowed(r)
+
+    for _, tc := range []struct {
+        method, path, allow string
+    }{
+        {"POST", "/api/health", "GET"},
+        {"DELETE", "/api/health", "GET"},
+        {"PUT", "/api/customers", "GET, POST"},
+    } {
+        rec := httptest.NewRecorder()
+        r.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, nil))
+        if rec.Code != http.StatusMethodNotAllowed {
+            t.Errorf("%s %s: status %d, want 405", tc.method, tc.path, rec.Code)
+            continue
+        }
+        if got := rec.Header().Get("Allow"); got != tc.allow {
+            t.Errorf("%s %s: Allow %q, want %q", tc.method, tc.path, got, tc.allow)
+        }
+        if code := errorCode(t, rec); code != CodeMethodNotAllowed {
+            t.Errorf("%s %s: code %q, want %q", tc.method, tc.path, code, CodeMethodNotAllowed)
+        }
+    }
+}
+
+// quietLog discards log output for the rest of the test.
+func quietLog(t *testing.T) {
+    log.SetOutput(io.Discard)
+    t.Cleanup(func() { log.SetOutput(os.Stderr) })
+}
+
+func TestRecover(t *testing.T) {
+    quietLog(t)
+    boom := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        panic("boom")
+    })
+    for _, tc := range []struct {
+        name string
+        h    http.Handler
+    }{
+        {"alone", Recover(boom)},
+        // The order main uses: the panic is caught on Timeout's goroutine.
+        {"inside Timeout", Timeout(Recover(boom), time.Second)},
+        // Timeout re-raises a panic on the serving goroutine.
+        {"outside Timeout", Recover(Timeout(boom, time.Second))},
+    } {
+        rec := httptest.NewRecorder()
+        tc.h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/customers", nil))
+        if rec.Code != http.StatusInternalServerError {
+            t.Errorf("%s: status %d, want 500", tc.name, rec.Code)
+            continue
+        }
+        if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+            t.Errorf("%s: Content-Type %q", tc.name, ct)
+        }
+        if code := errorCode(t, rec); code != CodeInternal {
+            t.Errorf("%s: code %q, want %q", tc.name, code, CodeInternal)
+        }
+        if strings.Contains(rec.Body.String(), "boom") {
+            t.Errorf("%s: body leaks the panic value: %s", tc.name, rec.Body)
+        }
+    }
+}
+
+func TestRecoverAbortHandler(t *testing.T) {
+    h := Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        panic(http.ErrAbortHandler)
+    }))
+    defer func() {
+        if v := recover(); v != http.ErrAbortHandler {
+            t.Errorf("recovered %v, want http.ErrAbortHandler passed on", v)
+        }
+    }()
+    h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/customers", nil))
+}
@@ -0,0 +1,132 @@
+package internal
+
+import (
+    "context"
+    "database/sql"
+    "embed"
+    "fmt"
+    "io/fs"
+    "log"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+// migration is one embedded file, named NNNN_description.sql.
+type migration struct {
+    version int
+    name    string
+    sql     string
+}
+
+// loadMigrations reads the dialect's migrations, oldest first.
+func loadMigrations() ([]migration, error) {
+    fsys := dialect.migrations()
+    files, err := fs.Glob(fsys, "*.sql")
+    if err != nil {
+        return nil, err
+    }
+    var out []migration
+    for _, name := range files {
+        prefix, _, ok := strings.Cut(name, "_")
+        v, err := strconv.Atoi(prefix)
+        if !ok || err != nil {
+            return nil, fmt.Errorf("migrate: %s: name must start with a numeric version", name)
+        }
+        body, err := fs.ReadFile(fsys, name)
+        if err != nil {
+            return nil, err
+        }
+        out = append(out, migration{version: v, name: name, sql: string(body)})
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].version < out[j].version })
+    return out, nil
+}
+
+// expectedSchemaVersion is the newest embedded migration: the schema version
+// this build needs.
+var expectedSchemaVersion = sync.OnceValues(func() (int, error) {
+    migrations, err := loadMigrations()
+    if err != nil || len(migrations) == 0 {
+        return 0, err
+    }
+    return migrations[len(migrations)-1].version, nil
+})
+
+// schemaVersion returns the newest applied migration, or 0 when migrations
+// have never run.
+func schemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+    var v int
+    err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&v)
+    if dialect.classify(err) == dbErrNoSuchTable {
+        return 0, nil
+    }
+    return v, err
+}
+
+// Migrate applies the dialect's embedded migrations newer than the version recorded in
+// schema_migrations, in order. A database lock keeps instances starting at the
+// same time from racing, and already-applied versions are skipped, so running
+// it on every start is safe.
+func Migrate(ctx context.Context, db *sql.DB) error {
+    migrations, err := loadMigrations()
+    if err != nil {
+        return err
+    }
+
+    // The lock is per connection, so pin one for the whole run.
+    conn, err := db.Conn(ctx)
+    if err != nil {
+        return err
+    }
+    defer conn.Close()
+
+    release, err := dialect.lockMigrations(ctx, conn)
+    if err != nil {
+        return err
+    }
+    defer release()
+
+    if _, err := conn.ExecContext(ctx, dialect.migrationsTable()); err != nil {
+        return err
+    }
+
+    var current int
+    if err := conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+        return err
+    }
+
+    for _, m := range migrations {
+        if m.version <= current {
+            continue
+        }
+        // The MySQL driver runs one statement per Exec, and MySQL DDL
+        // commits implicitly, so statements are applied one at a time. Each file
+        // should therefore be written to be safely re-runnable.
+        for _, stmt := range splitStatements(m.sql) {
+            if _, err := conn.ExecContext(ctx, stmt); err != nil {
+                return fmt.Errorf("migrate: %s: %w", m.name, err)
+            }
+        }
+        if _, err := conn.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES (?)`, m.version); err != nil {
+            return fmt.Errorf("migrate: %s: %w", m.name, err)
+        }
+        log.Printf("migrate: applied %s", m.name)
+    }
+    return nil
+}
+
+// splitStatements splits a migration file on semicolons that end a line.
+func splitStatements(src string) []string {
+    var out []string
+    for _, part := range strings.SplitAfter(src, ";\n") {
+        if s := strings.TrimSpace(part); s != "" {
+            out = append(out, strings.TrimSuffix(s, ";"))
+        }
+    }
+    return out
+}
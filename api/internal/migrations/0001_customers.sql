@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS customers (
+    id         INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    name       VARCHAR(255) NOT NULL,
+    email      VARCHAR(320) NULL,
+    created_at TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP    NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_customers_email (email),
+    KEY ix_customers_deleted_at (deleted_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
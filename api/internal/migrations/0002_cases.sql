@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS cases (
+    id          INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    customer_id INT UNSIGNED NOT NULL,
+    title       VARCHAR(255) NOT NULL,
+    status      VARCHAR(32)  NOT NULL DEFAULT 'open',
+    created_at  TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY ix_cases_customer (customer_id),
+    KEY ix_cases_status (status),
+    CONSTRAINT fk_cases_customer
+      FOREIGN KEY (customer_id) REFERENCES customers(id)
+      ON UPDATE CASCADE ON DELETE RESTRICT
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
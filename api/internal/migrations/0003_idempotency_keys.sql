@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    idem_key      VARCHAR(255) NOT NULL,
+    request_hash  CHAR(64)     NOT NULL,
+    status_code   SMALLINT     NOT NULL,
+    response_body MEDIUMBLOB   NOT NULL,
+    created_at    TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (idem_key),
+    KEY ix_idempotency_keys_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
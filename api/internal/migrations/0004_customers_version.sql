@@ -0,0 +1,3 @@
+ALTER TABLE customers
+    ADD COLUMN IF NOT EXISTS version    INT UNSIGNED NOT NULL DEFAULT 1,
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS audit_log (
+    id          BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    actor       VARCHAR(255)    NOT NULL,
+    action      VARCHAR(32)     NOT NULL,
+    entity      VARCHAR(32)     NOT NULL,
+    entity_id   INT UNSIGNED    NOT NULL,
+    before_json JSON            NULL,
+    after_json  JSON            NULL,
+    created_at  TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY ix_audit_log_entity (entity, entity_id),
+    KEY ix_audit_log_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,2 @@
+ALTER TABLE cases
+    ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMP NULL DEFAULT NULL;
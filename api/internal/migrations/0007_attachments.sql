@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS attachments (
+    id           INT UNSIGNED    NOT NULL AUTO_INCREMENT,
+    case_id      INT UNSIGNED    NOT NULL,
+    filename     VARCHAR(255)    NOT NULL,
+    content_type VARCHAR(255)    NOT NULL,
+    size         BIGINT UNSIGNED NOT NULL,
+    url          VARCHAR(2048)   NOT NULL,
+    created_at   TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY ix_attachments_case (case_id),
+    CONSTRAINT fk_attachments_case
+      FOREIGN KEY (case_id) REFERENCES cases(id)
+      ON UPDATE CASCADE ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,3 @@
+ALTER TABLE cases
+    ADD COLUMN IF NOT EXISTS assignee VARCHAR(255) NULL DEFAULT NULL,
+    ADD INDEX IF NOT EXISTS ix_cases_assignee (assignee);
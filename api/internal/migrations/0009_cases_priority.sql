@@ -0,0 +1,3 @@
+ALTER TABLE cases
+    ADD COLUMN IF NOT EXISTS priority VARCHAR(16) NOT NULL DEFAULT 'medium',
+    ADD INDEX IF NOT EXISTS ix_cases_priority (priority);
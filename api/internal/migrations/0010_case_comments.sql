@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS case_comments (
+    id         INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    case_id    INT UNSIGNED NOT NULL,
+    author     VARCHAR(64)  NOT NULL,
+    body       TEXT         NOT NULL,
+    created_at TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY ix_case_comments_case (case_id, id),
+    CONSTRAINT fk_case_comments_case
+      FOREIGN KEY (case_id) REFERENCES cases(id)
+      ON UPDATE CASCADE ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
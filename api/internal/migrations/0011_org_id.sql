@@ -0,0 +1,15 @@
+ALTER TABLE customers
+    ADD COLUMN IF NOT EXISTS org_id INT UNSIGNED NOT NULL DEFAULT 1 AFTER id,
+    ADD INDEX IF NOT EXISTS ix_customers_org (org_id, id),
+    ADD UNIQUE INDEX IF NOT EXISTS uq_customers_org_email (org_id, email),
+    DROP INDEX IF EXISTS uq_customers_email;
+ALTER TABLE cases
+    ADD COLUMN IF NOT EXISTS org_id INT UNSIGNED NOT NULL DEFAULT 1 AFTER id,
+    ADD INDEX IF NOT EXISTS ix_cases_org (org_id, id);
+ALTER TABLE audit_log
+    ADD COLUMN IF NOT EXISTS org_id INT UNSIGNED NOT NULL DEFAULT 1 AFTER id,
+    ADD INDEX IF NOT EXISTS ix_audit_log_org (org_id, id);
+ALTER TABLE idempotency_keys
+    ADD COLUMN IF NOT EXISTS org_id INT UNSIGNED NOT NULL DEFAULT 1 FIRST,
+    DROP PRIMARY KEY,
+    ADD PRIMARY KEY (org_id, idem_key);
@@ -0,0 +1,3 @@
+ALTER TABLE cases
+    ADD COLUMN IF NOT EXISTS due_at TIMESTAMP NULL DEFAULT NULL,
+    ADD INDEX IF NOT EXISTS ix_cases_org_due (org_id, due_at);
@@ -0,0 +1,2 @@
+ALTER TABLE customers
+    ADD COLUMN IF NOT EXISTS phone VARCHAR(16) NULL DEFAULT NULL AFTER email;
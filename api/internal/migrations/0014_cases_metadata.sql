@@ -0,0 +1,2 @@
+ALTER TABLE cases
+    ADD COLUMN IF NOT EXISTS metadata JSON NULL DEFAULT NULL CHECK (JSON_VALID(metadata));
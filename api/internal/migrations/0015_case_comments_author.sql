@@ -0,0 +1,2 @@
+ALTER TABLE case_comments
+    MODIFY author VARCHAR(255) NOT NULL;
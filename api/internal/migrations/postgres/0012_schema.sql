@@ -0,0 +1,90 @@
+CREATE TABLE IF NOT EXISTS customers (
+    id         SERIAL       NOT NULL,
+    org_id     INTEGER      NOT NULL DEFAULT 1,
+    name       VARCHAR(255) NOT NULL,
+    email      VARCHAR(320) NULL,
+    version    INTEGER      NOT NULL DEFAULT 1,
+    created_at TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP    NULL,
+    PRIMARY KEY (id),
+    CONSTRAINT uq_customers_org_email UNIQUE (org_id, email)
+);
+CREATE INDEX IF NOT EXISTS ix_customers_org ON customers (org_id, id);
+CREATE INDEX IF NOT EXISTS ix_customers_deleted_at ON customers (deleted_at);
+CREATE OR REPLACE FUNCTION touch_updated_at() RETURNS trigger AS $$ BEGIN NEW.updated_at = CURRENT_TIMESTAMP; RETURN NEW; END $$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS customers_updated_at ON customers;
+CREATE TRIGGER customers_updated_at BEFORE UPDATE ON customers FOR EACH ROW EXECUTE FUNCTION touch_updated_at();
+CREATE TABLE IF NOT EXISTS cases (
+    id                SERIAL       NOT NULL,
+    org_id            INTEGER      NOT NULL DEFAULT 1,
+    customer_id       INTEGER      NOT NULL,
+    title             VARCHAR(255) NOT NULL,
+    status            VARCHAR(32)  NOT NULL DEFAULT 'open',
+    priority          VARCHAR(16)  NOT NULL DEFAULT 'medium',
+    assignee          VARCHAR(255) NULL DEFAULT NULL,
+    due_at            TIMESTAMP    NULL DEFAULT NULL,
+    status_changed_at TIMESTAMP    NULL DEFAULT NULL,
+    created_at        TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_cases_customer
+      FOREIGN KEY (customer_id) REFERENCES customers(id)
+      ON UPDATE CASCADE ON DELETE RESTRICT
+);
+CREATE INDEX IF NOT EXISTS ix_cases_org ON cases (org_id, id);
+CREATE INDEX IF NOT EXISTS ix_cases_customer ON cases (customer_id);
+CREATE INDEX IF NOT EXISTS ix_cases_status ON cases (status);
+CREATE INDEX IF NOT EXISTS ix_cases_priority ON cases (priority);
+CREATE INDEX IF NOT EXISTS ix_cases_assignee ON cases (assignee);
+CREATE INDEX IF NOT EXISTS ix_cases_org_due ON cases (org_id, due_at);
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    org_id        INTEGER      NOT NULL DEFAULT 1,
+    idem_key      VARCHAR(255) NOT NULL,
+    request_hash  CHAR(64)     NOT NULL,
+    status_code   SMALLINT     NOT NULL,
+    response_body BYTEA        NOT NULL,
+    created_at    TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (org_id, idem_key)
+);
+CREATE INDEX IF NOT EXISTS ix_idempotency_keys_created_at ON idempotency_keys (created_at);
+CREATE TABLE IF NOT EXISTS audit_log (
+    id          BIGSERIAL    NOT NULL,
+    org_id      INTEGER      NOT NULL DEFAULT 1,
+    actor       VARCHAR(255) NOT NULL,
+    action      VARCHAR(32)  NOT NULL,
+    entity      VARCHAR(32)  NOT NULL,
+    entity_id   INTEGER      NOT NULL,
+    before_json JSONB        NULL,
+    after_json  JSONB        NULL,
+    created_at  TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS ix_audit_log_org ON audit_log (org_id, id);
+CREATE INDEX IF NOT EXISTS ix_audit_log_entity ON audit_log (entity, entity_id);
+CREATE INDEX IF NOT EXISTS ix_audit_log_created_at ON audit_log (created_at);
+CREATE TABLE IF NOT EXISTS attachments (
+    id           SERIAL        NOT NULL,
+    case_id      INTEGER       NOT NULL,
+    filename     VARCHAR(255)  NOT NULL,
+    content_type VARCHAR(255)  NOT NULL,
+    size         BIGINT        NOT NULL,
+    url          VARCHAR(2048) NOT NULL,
+    created_at   TIMESTAMP     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_attachments_case
+      FOREIGN KEY (case_id) REFERENCES cases(id)
+      ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS ix_attachments_case ON attachments (case_id);
+CREATE TABLE IF NOT EXISTS case_comments (
+    id         SERIAL      NOT NULL,
+    case_id    INTEGER     NOT NULL,
+    author     VARCHAR(64) NOT NULL,
+    body       TEXT        NOT NULL,
+    created_at TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_case_comments_case
+      FOREIGN KEY (case_id) REFERENCES cases(id)
+      ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS ix_case_comments_case ON case_comments (case_id, id);
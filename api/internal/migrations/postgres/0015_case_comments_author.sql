@@ -0,0 +1,2 @@
+ALTER TABLE case_comments
+    ALTER COLUMN author TYPE VARCHAR(255);
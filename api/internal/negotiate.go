@@ -0,0 +1,95 @@
+package internal
+
+import (
+    "encoding/json"
+    "encoding/xml"
+    "mime"
+    "net/http"
+    "slices"
+    "strconv"
+    "strings"
+)
+
+const (
+    mediaJSON = "application/json"
+    mediaXML  = "application/xml"
+)
+
+// negotiate picks the response type for r's Accept header: JSON when the
+// header is absent or allows anything, XML when the client prefers
+// application/xml or text/xml. When Accept rules out both it writes 406 and
+// returns false.
+func negotiate(w http.ResponseWriter, r *http.Request) (string, bool) {
+    if !slices.Contains(w.Header().Values("Vary"), "Accept") {
+        w.Header().Add("Vary", "Accept")
+    }
+    accept := r.Header.Get("Accept")
+    if strings.TrimSpace(accept) == "" {
+        return mediaJSON, true
+    }
+
+    best, bestQ := "", 0.0
+    for _, part := range strings.Split(accept, ",") {
+        mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+        if err != nil {
+            continue
+        }
+        q := 1.0
+        if v, ok := params["q"]; ok {
+            if q, err = strconv.ParseFloat(v, 64); err != nil {
+                continue
+            }
+        }
+        var offer string
+        switch mt {
+        case "application/json", "application/*", "*/*":
+            offer = mediaJSON
+        case "application/xml", "text/xml":
+            offer = mediaXML
+        default:
+            continue
+        }
+        // On equal q, JSON wins.
+        if q > bestQ || (q == bestQ && q > 0 && offer == mediaJSON) {
+            best, bestQ = offer, q
+        }
+    }
+    if best == "" {
+        writeError(w, http.StatusNotAcceptable, CodeNotAcceptable, "this endpoint responds with application/json or application/xml")
+        return "", false
+    }
+    return best, true
+}
+
+// encodeAs renders v as mt, newline-terminated, applying w's null policy
+// to JSON.
+func encodeAs(w http.ResponseWriter, mt string, v any) ([]byte, error) {
+    if mt == mediaXML {
+        b, err := xml.Marshal(v)
+        if err != nil {
+            return nil, err
+        }
+        return append([]byte(xml.Header), append(b, '\n')...), nil
+    }
+    b, err := json.Marshal(v)
+    if err == nil && omitNulls(w) {
+        return dropNulls(b)
+    }
+    return append(b, '\n'), err
+}
+
+// respond writes payload with status in the type negotiate picks for r.
+func respond(w http.ResponseWriter, r *http.Request, status int, payload any) {
+    mt, ok := negotiate(w, r)
+    if !ok {
+        return
+    }
+    body, err := encodeAs(w, mt, payload)
+    if err != nil {
+        dbError(w, err)
+        return
+    }
+    w.Header().Set("Content-Type", mt)
+    w.WriteHeader(status)
+    w.Write(body)
+}
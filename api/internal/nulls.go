@@ -0,0 +1,149 @@
+package internal
+
+import (
+    "bytes"
+    "encoding/json"
+    "mime"
+    "net/http"
+    "slices"
+    "strings"
+)
+
+// Null policies for JSON responses. Fields that can be null are pointers
+// without omitempty, so by default every response carries them, as explicit
+// nulls when unset, in lists and detail responses alike. Under nullsOmit
+// writeJSON drops each object member whose value is null; nulls inside
+// arrays are kept, since dropping them would shift positions.
+const (
+    nullsInclude = "include"
+    nullsOmit    = "omit"
+)
+
+// verbatimMembers hold client-supplied JSON, which is returned as sent under
+// either policy: only a null member itself is dropped, never anything inside.
+var verbatimMembers = map[string]bool{
+    "metadata": true,
+}
+
+// nullsWriter carries the null policy chosen for a request to writeJSON.
+type nullsWriter struct {
+    http.ResponseWriter
+    omit bool
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (nw *nullsWriter) Unwrap() http.ResponseWriter {
+    return nw.ResponseWriter
+}
+
+// NullPolicy sets how writeJSON renders null fields for each request: the
+// client's "nulls" parameter on application/json in Accept (e.g.
+// "Accept: application/json; nulls=omit") when it gives one, and def
+// (JSON_NULLS) otherwise. It must wrap the router directly so handlers see
+// its writer.
+func NullPolicy(next http.Handler, def string) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        policy := def
+        if p, ok := acceptedNulls(r.Header.Get("Accept")); ok {
+            policy = p
+        }
+        if !slices.Contains(w.Header().Values("Vary"), "Accept") {
+            w.Header().Add("Vary", "Accept")
+        }
+        next.ServeHTTP(&nullsWriter{ResponseWriter: w, omit: policy == nullsOmit}, r)
+    })
+}
+
+// acceptedNulls returns the nulls parameter of the first application/json
+// entry in accept that has a valid one.
+func acceptedNulls(accept string) (string, bool) {
+    for _, part := range strings.Split(accept, ",") {
+        mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+        if err != nil || mt != "application/json" {
+            continue
+        }
+        if p := params["nulls"]; p == nullsInclude || p == nullsOmit {
+            return p, true
+        }
+    }
+    return "", false
+}
+
+// omitNulls reports whether w was set up by NullPolicy to drop nulls.
+func omitNulls(w http.ResponseWriter) bool {
+    nw, ok := w.(*nullsWriter)
+    return ok && nw.omit
+}
+
+// dropNulls re-encodes the JSON document b without null object members,
+// keeping member order.
+func dropNulls(b []byte) ([]byte, error) {
+    dec := json.NewDecoder(bytes.NewReader(b))
+    dec.UseNumber()
+    var out bytes.Buffer
+    if err := copyDroppingNulls(dec, &out); err != nil {
+        return nil, err
+    }
+    out.WriteByte('\n')
+    return out.Bytes(), nil
+}
+
+// copyDroppingNulls copies the next value from dec to out.
+func copyDroppingNulls(dec *json.Decoder, out *bytes.Buffer) error {
+    tok, err := dec.Token()
+    if err != nil {
+        return err
+    }
+    switch tok {
+    case json.Delim('{'):
+        out.WriteByte('{')
+        first := true
+        for dec.More() {
+            key, err := dec.Token()
+            if err != nil {
+                return err
+            }
+            // Buffer the value so a null can be dropped with its key.
+            var val bytes.Buffer
+            if name, _ := key.(string); verbatimMembers[name] {
+                var raw json.RawMessage
+                if err := dec.Decode(&raw); err != nil {
+                    return err
+                }
+                val.Write(raw)
+            } else if err := copyDroppingNulls(dec, &val); err != nil {
+                return err
+            }
+            if val.String() == "null" {
+                continue
+            }
+            if !first {
+                out.WriteByte(',')
+            }
+            first = false
+            k, _ := json.Marshal(key)
+            out.Write(k)
+            out.WriteByte(':')
+            out.Write(val.Bytes())
+        }
+        _, err := dec.Token()
+        out.WriteByte('}')
+        return err
+    case json.Delim('['):
+        out.WriteByte('[')
+        for first := true; dec.More(); first = false {
+            if !first {
+                out.WriteByte(',')
+            }
+            if err := copyDroppingNulls(dec, out); err != nil {
+                return err
+            }
+        }
+        _, err := dec.Token()
+        out.WriteByte(']')
+        return err
+    }
+    v, err := json.Marshal(tok)
+    out.Write(v)
+    return err
+}
@@ -0,0 +1,415 @@
+package internal
+
+import (
+    "encoding/json"
+    "net/http"
+    "reflect"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// The OpenAPI document is assembled in code: paths are listed by hand below,
+// while every request and response schema is derived from the Go types'
+// json (and validate) tags by schemaOf, so the spec can't drift from the structs the
+// handlers actually encode and decode.
+
+var (
+    timeType     = reflect.TypeOf(time.Time{})
+    rawType      = reflect.TypeOf(json.RawMessage(nil))
+    optionalType = reflect.TypeOf(optionalString{})
+)
+
+// schemaOf returns the OpenAPI schema for t. Pointers are nullable, fields
+// without omitempty are required, and embedded structs are inlined the way
+// encoding/json flattens them.
+func schemaOf(t reflect.Type) map[string]any {
+    nullable := false
+    for t.Kind() == reflect.Pointer {
+        t, nullable = t.Elem(), true
+    }
+    var s map[string]any
+    switch {
+    case t == timeType:
+        s = map[string]any{"type": "string", "format": "date-time"}
+    case t == rawType:
+        s = map[string]any{}
+    case t == optionalType:
+        s = map[string]any{"type": "string", "nullable": true}
+    case t.Kind() == reflect.Struct:
+        props := map[string]any{}
+        var required []string
+        addFields(t, props, &required)
+        s = map[string]any{"type": "object", "properties": props}
+        if len(required) > 0 {
+            s["required"] = required
+        }
+    case t.Kind() == reflect.Slice:
+        s = map[string]any{"type": "array", "items": schemaOf(t.Elem())}
+    case t.Kind() == reflect.Map:
+        s = map[string]any{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+    case t.Kind() == reflect.Bool:
+        s = map[string]any{"type": "boolean"}
+    case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+        s = map[string]any{"type": "integer"}
+    case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+        s = map[string]any{"type": "number"}
+    case t.Kind() == reflect.String:
+        s = map[string]any{"type": "string"}
+    default:
+        s = map[string]any{}
+    }
+    if nullable {
+        s["nullable"] = true
+    }
+    return s
+}
+
+func addFields(t reflect.Type, props map[string]any, required *[]string) {
+    for i := 0; i < t.NumField(); i++ {
+        f := t.Field(i)
+        tag := f.Tag.Get("json")
+        if tag == "-" {
+            continue
+        }
+        name, opts, _ := strings.Cut(tag, ",")
+        if f.Anonymous && name == "" {
+            addFields(f.Type, props, required)
+            continue
+        }
+        if !f.IsExported() {
+            continue
+        }
+        if name == "" {
+            name = f.Name
+        }
+        props[name] = withConstraints(schemaOf(f.Type), f.Tag.Get("validate"))
+        if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer && f.Type != optionalType {
+            *required = append(*required, name)
+        }
+    }
+}
+
+// withConstraints copies the max (or lengthTags), min, oneof and jsonobject
+// rules of a validate tag into s as maxLength/maximum, an array's minItems,
+// enum and a nullable object type.
+func withConstraints(s map[string]any, tag string) map[string]any {
+    for _, rule := range strings.Split(tag, ",") {
+        k, v, _ := strings.Cut(rule, "=")
+        if n, ok := lengthTags[k]; ok {
+            k, v = "max", strconv.Itoa(n)
+        }
+        switch k {
+        case "max":
+            n, _ := strconv.Atoi(v)
+            if s["type"] == "string" {
+                s["maxLength"] = n
+            } else {
+                s["maximum"] = n
+            }
+        case "min":
+            if s["type"] == "array" {
+                n, _ := strconv.Atoi(v)
+                s["minItems"] = n
+            }
+        case "oneof":
+            s["enum"] = strings.Fields(v)
+        case "jsonobject":
+            s["type"], s["nullable"] = "object", true
+        }
+    }
+    return s
+}
+
+func schemaFor(v any) map[string]any { return schemaOf(reflect.TypeOf(v)) }
+
+func ref(name string) map[string]any {
+    return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+// pageSchema describes the {data, limit, offset, total, max_limit} list
+// envelope.
+func pageSchema(item string) map[string]any {
+    return map[string]any{
+        "type":     "object",
+        "required": []string{"data", "limit", "offset", "total", "max_limit"},
+        "properties": map[string]any{
+            "data":      map[string]any{"type": "array", "items": ref(item)},
+            "limit":     map[string]any{"type": "integer"},
+            "offset":    map[string]any{"type": "integer"},
+            "total":     map[string]any{"type": "integer"},
+            "max_limit": map[string]any{"type": "integer"},
+        },
+    }
+}
+
+func param(name, in, typ, desc string) map[string]any {
+    return map[string]any{"name": name, "in": in, "description": desc, "required": in == "path",
+        "schema": map[string]any{"type": typ}}
+}
+
+func jsonBody(schema string) map[string]any {
+    return map[string]any{"required": true, "content": map[string]any{
+        "application/json": map[string]any{"schema": ref(schema)}}}
+}
+
+func jsonResponse(desc string, schema map[string]any) map[string]any {
+    return map[string]any{"description": desc, "content": map[string]any{
+        "application/json": map[string]any{"schema": schema}}}
+}
+
+// op builds an operation. Every operation may answer with the common error
+// envelope, so that is added as the default response.
+func op(summary string, params []any, body map[string]any, responses map[string]any) map[string]any {
+    responses["default"] = jsonResponse("Error", ref("Error"))
+    o := map[string]any{"summary": summary, "responses": responses}
+    if params != nil {
+        o["parameters"] = params
+    }
+    if body != nil {
+        o["requestBody"] = body
+    }
+    return o
+}
+
+var (
+    pathID        = param("id", "path", "integer", "Customer id")
+    caseIDParam   = param("id", "path", "integer", "Case id")
+    pagingParams  = []any{param("limit", "query", "integer", "Page size, 1..max_limit; default and max_limit are configured per resource (50 and 200 unless set)"), param("offset", "query", "integer", "Rows to skip (default 0)"),
+        param("envelope", "query", "boolean", `Omit for the flat page object; false returns the bare data array, true nests limit, offset and total under "page"`)}
+    versionNote   = "The body must carry the version last read; a stale version gets 409 with the current state."
+    customerQuery = []any{
+        param("q", "query", "string", "Case-insensitive substring of name or email, or digits of the phone"),
+        param("include_deleted", "query", "boolean", "Include soft-deleted customers"),
+        param("sort", "query", "string", "id, name or created_at, prefixed with - for descending (default -id)"),
+        param("created_after", "query", "string", "RFC3339 timestamp or YYYY-MM-DD; created_at >= value"),
+        param("created_before", "query", "string", "RFC3339 timestamp or YYYY-MM-DD; created_at < value"),
+        param("ids", "query", "string", "Comma-separated customer ids, at most "+strconv.Itoa(maxBatchIDs)+"; ids that don't exist are omitted"),
+    }
+    statusParam   = param("status", "query", "string", "One of "+caseStatusList)
+    casePriorityParam = param("priority", "query", "string", "One of "+casePriorityList)
+    caseSortParam     = param("sort", "query", "string", "id, created_at, priority (by severity) or due_at (undated last), prefixed with - for descending (default -id)")
+    overdueParam      = param("overdue", "query", "boolean", "Only cases past due_at that aren't closed")
+    metaParam         = param("meta.{key}", "query", "string", "Only cases whose metadata has this value at top-level key {key}, compared as text; repeat with other keys to narrow further")
+    assigneeParams = []any{
+        param("assignee", "query", "string", "Only cases assigned to this agent"),
+        param("unassigned", "query", "boolean", "Only cases with no assignee"),
+    }
+    validateOnlyParam = param("validate_only", "query", "boolean", "Run every check, then roll back instead of creating")
+    fieldsParam   = param("fields", "query", "string", "Comma-separated subset of "+strings.Join(customerFields, ", "))
+
+    maintenanceSchema = map[string]any{"type": "object", "required": []string{"enabled"},
+        "properties": map[string]any{"enabled": map[string]any{"type": "boolean"}}}
+)
+
+func openAPISpec() map[string]any {
+    listParams := append(append(append([]any{}, pagingParams...), customerQuery...),
+        param("cursor", "query", "string", "Keyset pagination token, as returned in next_cursor; empty starts from the newest customer"), fieldsParam)
+    customerPageSchema := pageSchema("Customer")
+    customerPageSchema["properties"].(map[string]any)["next_cursor"] = map[string]any{"type": "string"}
+
+    return map[string]any{
+        "openapi": "3.0.3",
+        "info": map[string]any{"title": "CaseInventory API", "version": "1.0",
+            "description": "Unset fields are sent as explicit nulls, in lists and single-resource responses alike, unless the server runs with JSON_NULLS=omit. " +
+                "Send Accept: application/json; nulls=omit (or nulls=include) to choose per request."},
+        "security": []any{map[string]any{"bearerAuth": []string{}}},
+        "paths": map[string]any{
+            "/api/health": map[string]any{"get": op("Liveness probe", nil, nil, map[string]any{
+                "200": jsonResponse("Process is up", map[string]any{"type": "object"})})},
+            "/api/ready": map[string]any{"get": op("Readiness probe", nil, nil, map[string]any{
+                "200": jsonResponse("Database reachable", map[string]any{"type": "object"}),
+                "503": jsonResponse("Database unreachable", map[string]any{"type": "object"})})},
+            "/api/version": map[string]any{"get": op("Build information", nil, nil, map[string]any{
+                "200": jsonResponse("Commit, build time and Go version", map[string]any{"type": "object"})})},
+            "/api/customers": map[string]any{
+                "get": op("List customers", listParams, nil, map[string]any{
+                    "200": jsonResponse("A page of customers; X-Total-Count carries the total", customerPageSchema),
+                    "304": map[string]any{"description": "Not modified since If-Modified-Since"}}),
+                "head": op("Count customers without fetching them", customerQuery, nil, map[string]any{
+                    "200": map[string]any{"description": "No body; X-Total-Count carries the matching total"}}),
+                "post": op("Create a customer", []any{param("Idempotency-Key", "header", "string", "Replays the original response for a retried request"), validateOnlyParam},
+                    jsonBody("CustomerInput"), map[string]any{
+                        "201": jsonResponse("Created", ref("Customer")),
+                        "200": jsonResponse("Valid; nothing created (validate_only)", map[string]any{"type": "object"})}),
+            },
+            "/api/customers.csv": map[string]any{"get": op("Export customers as CSV", customerQuery, nil, map[string]any{
+                "200": map[string]any{"description": "CSV attachment", "content": map[string]any{"text/csv": map[string]any{"schema": map[string]any{"type": "string"}}}}})},
+            "/api/customers/bulk": map[string]any{"post": op("Create customers atomically", []any{validateOnlyParam},
+                map[string]any{"required": true, "content": map[string]any{"application/json": map[string]any{
+                    "schema": map[string]any{"type": "array", "items": ref("CustomerInput")}}}},
+                map[string]any{
+                    "201": jsonResponse("All rows created", ref("BulkResults")),
+                    "200": jsonResponse("All rows valid; nothing created (validate_only)", ref("BulkResults")),
+                    "400": jsonResponse("Some rows invalid; nothing created", ref("BulkResults"))})},
+            "/api/customers/count": map[string]any{"get": op("Count customers", customerQuery, nil, map[string]any{
+                "200": jsonResponse("Matching total", map[string]any{"type": "object", "properties": map[string]any{"total": map[string]any{"type": "integer"}}})})},
+            "/api/customers/{id}": map[string]any{
+                "get": op("Get a customer", []any{pathID, fieldsParam, param("If-None-Match", "header", "string", "ETag from an earlier response")}, nil, map[string]any{
+                    "200": jsonResponse("The customer", ref("Customer")),
+                    "304": map[string]any{"description": "Not modified"}}),
+                "put": op("Replace a customer. "+versionNote, []any{pathID}, jsonBody("CustomerUpdate"), map[string]any{
+                    "200": jsonResponse("Updated", ref("Customer"))}),
+                "patch": op("Update some customer fields. "+versionNote, []any{pathID}, jsonBody("CustomerPatch"), map[string]any{
+                    "200": jsonResponse("Updated", ref("Customer"))}),
+                "delete": op("Soft-delete a customer",
+                    []any{pathID, param("If-Unmodified-Since", "header", "string", "HTTP date; delete only if the customer wasn't updated after it")},
+                    nil, map[string]any{
+                        "204": map[string]any{"description": "Deleted"},
+                        "412": jsonResponse("Updated since If-Unmodified-Since; not deleted", ref("Error"))}),
+            },
+            "/api/customers/{id}/restore": map[string]any{"post": op("Restore a soft-deleted customer", []any{pathID}, nil, map[string]any{
+                "200": jsonResponse("Restored", ref("Customer"))})},
+            "/api/customers/{id}/merge": map[string]any{"post": op("Merge source_id into this customer: its cases move here, missing fields are copied, and it is soft-deleted",
+                []any{pathID}, jsonBody("MergeInput"), map[string]any{
+                    "200": jsonResponse("The merged customer", ref("Customer")),
+                    "400": jsonResponse("Invalid body, or source_id is this customer", ref("Error")),
+                    "404": jsonResponse("Either customer doesn't exist", ref("Error")),
+                    "409": jsonResponse("Either customer is soft-deleted", ref("Error"))})},
+            "/api/customers/{id}/cases": map[string]any{"get": op("List a customer's cases",
+                append(append([]any{pathID}, pagingParams...), append([]any{statusParam, casePriorityParam, overdueParam, metaParam, caseSortParam}, assigneeParams...)...), nil, map[string]any{
+                    "200": jsonResponse("A page of cases", pageSchema("Case"))})},
+            "/api/customers/{id}/timeline": map[string]any{"get": op("A customer's cases, comments and audit entries, newest first",
+                append([]any{pathID}, pagingParams...), nil, map[string]any{
+                    "200": jsonResponse("A page of timeline items", pageSchema("TimelineItem")),
+                    "404": jsonResponse("No such customer", ref("Error"))})},
+            "/api/cases/stats": map[string]any{"get": op("Case counts per status, every status included",
+                append([]any{param("customer_id", "query", "integer", "Only this customer's cases"), statusParam, casePriorityParam, overdueParam, metaParam}, assigneeParams...), nil, map[string]any{
+                    "200": jsonResponse("Count per status", map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "integer"}})})},
+            "/api/cases/stream": map[string]any{"get": op("Server-Sent Events stream with a case.created event for each new case", nil, nil, map[string]any{
+                "200": map[string]any{"description": "An open event stream; each event's data is a Case",
+                    "content": map[string]any{"text/event-stream": map[string]any{"schema": map[string]any{"type": "string"}}}},
+                "503": jsonResponse("Too many open streams; retry later", ref("Error"))})},
+            "/api/cases": map[string]any{
+                "get": op("List cases", append(append([]any{}, pagingParams...),
+                    append([]any{param("customer_id", "query", "integer", "Only this customer's cases"), statusParam, casePriorityParam, overdueParam, caseSortParam}, assigneeParams...)...), nil, map[string]any{
+                    "200": jsonResponse("A page of cases", pageSchema("Case"))}),
+                "post": op("Open a case", nil, jsonBody("CaseInput"), map[string]any{
+                    "201": jsonResponse("Created", ref("Case"))}),
+            },
+            "/api/cases/bulk-status": map[string]any{"post": op("Move many cases to one status in a single transaction", nil,
+                map[string]any{"required": true, "content": map[string]any{"application/json": map[string]any{
+                    "schema": schemaFor(bulkStatusInput{})}}},
+                map[string]any{"200": jsonResponse("Per-id results", map[string]any{"type": "object", "properties": map[string]any{
+                    "results": map[string]any{"type": "array", "items": schemaFor(bulkStatusResult{})}}})})},
+            "/api/cases/{id}/priority": map[string]any{"patch": op("Set a case's priority", []any{caseIDParam},
+                map[string]any{"required": true, "content": map[string]any{"application/json": map[string]any{
+                    "schema": schemaFor(casePriorityInput{})}}},
+                map[string]any{"200": jsonResponse("Updated", ref("Case"))})},
+            "/api/cases/{id}/due": map[string]any{"patch": op("Set or clear a case's due date", []any{caseIDParam},
+                map[string]any{"required": true, "content": map[string]any{"application/json": map[string]any{
+                    "schema": map[string]any{"type": "object", "required": []string{"due_at"},
+                        "properties": map[string]any{"due_at": map[string]any{"type": "string", "format": "date-time", "nullable": true}}}}}},
+                map[string]any{"200": jsonResponse("Updated", ref("Case"))})},
+            "/api/cases/{id}/metadata": map[string]any{"patch": op("Replace or clear a case's metadata", []any{caseIDParam},
+                map[string]any{"required": true, "content": map[string]any{"application/json": map[string]any{
+                    "schema": map[string]any{"type": "object", "required": []string{"metadata"},
+                        "properties": map[string]any{"metadata": map[string]any{"type": "object", "nullable": true}}}}}},
+                map[string]any{"200": jsonResponse("Updated", ref("Case"))})},
+            "/api/cases/{id}/assignee": map[string]any{
+                "put": op("Assign a case to an agent", []any{caseIDParam},
+                    map[string]any{"required": true, "content": map[string]any{"application/json": map[string]any{
+                        "schema": schemaFor(assigneeInput{})}}},
+                    map[string]any{"200": jsonResponse("Updated", ref("Case"))}),
+                "delete": op("Unassign a case", []any{caseIDParam}, nil, map[string]any{
+                    "200": jsonResponse("Updated", ref("Case"))}),
+            },
+            "/api/cases/{id}/comments": map[string]any{
+                "get": op("List a case's comments, oldest first", append([]any{caseIDParam}, pagingParams...), nil, map[string]any{
+                    "200": jsonResponse("A page of comments", pageSchema("Comment"))}),
+                "post": op("Comment on a case; the author is the caller's API key or JWT subject", []any{caseIDParam},
+                    jsonBody("CommentInput"), map[string]any{"201": jsonResponse("Created", ref("Comment"))})},
+            "/api/cases/{id}/attachments": map[string]any{
+                "get": op("List a case's attachments", append([]any{caseIDParam}, pagingParams...), nil, map[string]any{
+                    "200": jsonResponse("A page of attachments", pageSchema("Attachment"))}),
+                "post": op("Register an attachment's metadata; the file itself is stored elsewhere", []any{caseIDParam},
+                    jsonBody("AttachmentInput"), map[string]any{"201": jsonResponse("Created", ref("Attachment"))})},
+            "/api/cases/{id}/status": map[string]any{"patch": op("Move a case through the workflow; a disallowed transition is 409",
+                []any{caseIDParam},
+                map[string]any{"required": true, "content": map[string]any{"application/json": map[string]any{
+                    "schema": schemaFor(caseStatusInput{})}}},
+                map[string]any{"200": jsonResponse("Updated", ref("Case"))})},
+            "/api/search": map[string]any{"get": op("Search customers and cases; a lookup that fails is left out with a warning",
+                []any{param("q", "query", "string", "Substring of customer name, email or phone, or case title"),
+                    param("limit", "query", "integer", "Hits per type, 1..50 (default 10)")}, nil,
+                map[string]any{"200": jsonResponse("Hits tagged with their type", schemaFor(searchResult{}))})},
+            "/api/stats": map[string]any{"get": op("Dashboard counts, cached for STATS_CACHE_TTL", nil, nil, map[string]any{
+                "200": jsonResponse("Customer and case aggregates", ref("Stats"))})},
+            "/api/admin/db-stats": map[string]any{"get": op("Connection pool statistics and circuit breaker state", nil, nil, map[string]any{
+                "200": jsonResponse("Pool and breaker state", map[string]any{"type": "object"})})},
+            "/api/admin/audit": map[string]any{"get": op("List audit entries", append(append([]any{}, pagingParams...),
+                param("entity", "query", "string", "customer, case, attachment or comment"),
+                param("entity_id", "query", "integer", "Only this entity's entries")), nil, map[string]any{
+                "200": jsonResponse("A page of audit entries", pageSchema("AuditEntry"))})},
+            "/api/admin/stats/refresh": map[string]any{"post": op("Recompute the dashboard counts now and replace the cached result", nil, nil, map[string]any{
+                "200": jsonResponse("Freshly computed aggregates", ref("Stats"))})},
+            "/api/admin/maintenance": map[string]any{
+                "get": op("Whether maintenance mode is on", nil, nil, map[string]any{
+                    "200": jsonResponse("Current mode", maintenanceSchema)}),
+                "put": op("Turn maintenance mode on or off; while on, every other write gets 503 with Retry-After", nil,
+                    map[string]any{"required": true, "content": map[string]any{"application/json": map[string]any{"schema": maintenanceSchema}}},
+                    map[string]any{"200": jsonResponse("New mode", maintenanceSchema)}),
+            },
+        },
+        "components": map[string]any{
+            "securitySchemes": map[string]any{"bearerAuth": map[string]any{"type": "http", "scheme": "bearer",
+                "description": "An API key, or a JWT when JWT auth is configured. /api/admin/* needs an admin API key or a JWT with the admin role; other credentials get 403"}},
+            "schemas": map[string]any{
+                "Customer":       schemaFor(Customer{}),
+                "CustomerInput":  schemaFor(CustomerInput{}),
+                "CustomerUpdate": schemaFor(customerUpdate{}),
+                "CustomerPatch":  schemaFor(customerPatch{}),
+                "MergeInput":     schemaFor(mergeInput{}),
+                "BulkResults": map[string]any{"type": "object", "properties": map[string]any{
+                    "results": map[string]any{"type": "array", "items": schemaFor(bulkResult{})}}},
+                "Case":            schemaFor(Case{}),
+                "CaseInput":       schemaFor(caseInput{}),
+                "Attachment":      schemaFor(Attachment{}),
+                "AttachmentInput": schemaFor(attachmentInput{}),
+                "Comment":         schemaFor(Comment{}),
+                "CommentInput":    schemaFor(commentInput{}),
+                "AuditEntry":      schemaFor(AuditEntry{}),
+                "Stats":           schemaFor(Stats{}),
+                "TimelineItem":    schemaFor(timelineItem{}),
+                "Error":           schemaFor(errorBody{}),
+            },
+        },
+    }
+}
+
+var (
+    openAPIOnce sync.Once
+    openAPIJSON []byte
+)
+
+// OpenAPI serves the API description as JSON.
+func (h *Handler) OpenAPI(w http.ResponseWriter, r *http.Request) {
+    openAPIOnce.Do(func() {
+        openAPIJSON, _ = json.MarshalIndent(openAPISpec(), "", "  ")
+    })
+    w.Header().Set("Content-Type","application/json")
+    w.Write(openAPIJSON)
+}
+
+// swaggerUIPage renders /api/openapi.json with Swagger UI from a CDN.
+const swaggerUIPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>CaseInventory API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>SwaggerUIBundle({url: "/api/openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+// Docs serves the Swagger UI page for the API.
+func (h *Handler) Docs(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "text/html; charset=utf-8")
+    w.Write([]byte(swaggerUIPage))
+}
@@ -0,0 +1,38 @@
+package internal
+
+import (
+    "encoding/json"
+    "time"
+)
+
+// optionalString is a JSON field that tells an absent key apart from an
+// explicit null: Set is false when the key was absent, and Value is nil
+// when it was null.
+type optionalString struct {
+    Set   bool
+    Value *string
+}
+
+func (o *optionalString) UnmarshalJSON(b []byte) error {
+    o.Set = true
+    if string(b) == "null" {
+        o.Value = nil
+        return nil
+    }
+    return json.Unmarshal(b, &o.Value)
+}
+
+// optionalTime is optionalString for an RFC3339 timestamp.
+type optionalTime struct {
+    Set   bool
+    Value *time.Time
+}
+
+func (o *optionalTime) UnmarshalJSON(b []byte) error {
+    o.Set = true
+    if string(b) == "null" {
+        o.Value = nil
+        return nil
+    }
+    return json.Unmarshal(b, &o.Value)
+}
@@ -0,0 +1,42 @@
+package internal
+
+import (
+    "encoding/json"
+    "testing"
+)
+
+func TestOptionalStringDecode(t *testing.T) {
+    for _, tc := range []struct {
+        body  string
+        set   bool
+        value *string
+    }{
+        {`{"version": 1, "email": "ada@example.com"}`, true, ptr("ada@example.com")},
+        {`{"version": 1, "email": ""}`, true, ptr("")},
+        {`{"version": 1, "email": null}`, true, nil},
+        {`{"version": 1}`, false, nil},
+    } {
+        var in customerPatch
+        if err := json.Unmarshal([]byte(tc.body), &in); err != nil {
+            t.Errorf("%s: %v", tc.body, err)
+            continue
+        }
+        if in.Email.Set != tc.set {
+            t.Errorf("%s: Set = %v, want %v", tc.body, in.Email.Set, tc.set)
+        }
+        if !equalPtr(in.Email.Value, tc.value) {
+            t.Errorf("%s: Value = %v, want %v", tc.body, in.Email.Value, tc.value)
+        }
+    }
+
+    var in customerPatch
+    if err := json.Unmarshal([]byte(`{"email": 42}`), &in); err == nil {
+        t.Error("a number for email decoded without error")
+    }
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func equalPtr[T comparable](a, b *T) bool {
+    return (a == nil) == (b == nil) && (a == nil || *a == *b)
+}
@@ -0,0 +1,62 @@
+package internal
+
+import (
+    "context"
+    "log"
+    "time"
+)
+
+// purgeBatchSize caps how many rows one purge DELETE removes, so a large
+// backlog is cleared in short statements rather than one long lock.
+const purgeBatchSize = 1000
+
+// purgeQueryTimeout bounds one purge batch.
+const purgeQueryTimeout = 30 * time.Second
+
+// Purge hard-deletes customers soft-deleted more than retention ago,
+// returning how many were removed. Customers that still have cases are kept,
+// since the cases reference them.
+func (r *CustomerRepo) Purge(ctx context.Context, retention time.Duration) (int64, error) {
+    var total int64
+    for {
+        bctx, cancel := context.WithTimeout(ctx, purgeQueryTimeout)
+        res, err := r.db.ExecContext(bctx, dialect.deleteLimit("customers", `deleted_at < `+dialect.secondsAgo()+`
+              AND NOT EXISTS (SELECT 1 FROM cases WHERE cases.customer_id = customers.id)`),
+            int64(retention.Seconds()), purgeBatchSize)
+        cancel()
+        if err != nil {
+            return total, err
+        }
+        n, err := res.RowsAffected()
+        if err != nil {
+            return total, err
+        }
+        total += n
+        if n < purgeBatchSize {
+            return total, nil
+        }
+    }
+}
+
+// RunPurge calls repo.Purge every interval until ctx is cancelled, logging
+// what each pass removed.
+func RunPurge(ctx context.Context, repo *CustomerRepo, interval, retention time.Duration) {
+    log.Printf("purge: removing customers deleted more than %s ago, every %s", retention, interval)
+    t := time.NewTicker(interval)
+    defer t.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-t.C:
+            n, err := repo.Purge(ctx, retention)
+            if err != nil && ctx.Err() == nil {
+                log.Printf("purge: %v (removed %d before the error)", err, n)
+                continue
+            }
+            if n > 0 {
+                log.Printf("purge: removed %d soft-deleted customers", n)
+            }
+        }
+    }
+}
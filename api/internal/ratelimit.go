@@ -0,0 +1,111 @@
+package internal
+
+import (
+    "context"
+    "math"
+    "net"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+
+    "golang.org/x/time/rate"
+)
+
+const (
+    // maxRateClients bounds the limiter map. Clients first seen while it is
+    // full share a single overflow bucket instead of growing the map.
+    maxRateClients = 10000
+    // rateClientIdle is how long a client may go unseen before its bucket is
+    // evicted.
+    rateClientIdle = 10 * time.Minute
+)
+
+type rateClient struct {
+    limiter  *rate.Limiter
+    lastSeen time.Time
+}
+
+// RateLimiter is a per-client token bucket limiter. Clients are identified by
+// their principal (API key or JWT subject) when authenticated and by IP
+// address otherwise.
+type RateLimiter struct {
+    rps      rate.Limit
+    burst    int
+    mu       sync.Mutex
+    clients  map[string]*rateClient
+    overflow *rate.Limiter
+}
+
+func NewRateLimiter(rps float64, burst int) *RateLimiter {
+    return &RateLimiter{
+        rps:      rate.Limit(rps),
+        burst:    burst,
+        clients:  map[string]*rateClient{},
+        overflow: rate.NewLimiter(rate.Limit(rps), burst),
+    }
+}
+
+// Run evicts idle clients until ctx is cancelled.
+func (rl *RateLimiter) Run(ctx context.Context) {
+    t := time.NewTicker(time.Minute)
+    defer t.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case now := <-t.C:
+            rl.mu.Lock()
+            for k, c := range rl.clients {
+                if now.Sub(c.lastSeen) > rateClientIdle {
+                    delete(rl.clients, k)
+                }
+            }
+            rl.mu.Unlock()
+        }
+    }
+}
+
+func (rl *RateLimiter) limiter(key string) *rate.Limiter {
+    rl.mu.Lock()
+    defer rl.mu.Unlock()
+    c, ok := rl.clients[key]
+    if !ok {
+        if len(rl.clients) >= maxRateClients {
+            return rl.overflow
+        }
+        c = &rateClient{limiter: rate.NewLimiter(rl.rps, rl.burst)}
+        rl.clients[key] = c
+    }
+    c.lastSeen = time.Now()
+    return c.limiter
+}
+
+// Limit rejects requests over the client's rate with 429 and a Retry-After
+// header. It must run behind RequireAuth to see the caller's principal.
+func (rl *RateLimiter) Limit(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        key := "ip:" + clientIP(r)
+        if u, ok := UserFromContext(r.Context()); ok {
+            key = u.ID
+        }
+
+        res := rl.limiter(key).Reserve()
+        if delay := res.Delay(); delay > 0 {
+            res.Cancel()
+            w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+            writeError(w, http.StatusTooManyRequests, CodeRateLimited, "too many requests")
+            return
+        }
+        next.ServeHTTP(w, r)
+    })
+}
+
+// clientIP is the remote address without its port.
+func clientIP(r *http.Request) string {
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        return r.RemoteAddr
+    }
+    return host
+}
@@ -0,0 +1,66 @@
+package internal
+
+import (
+    "context"
+    "crypto/rand"
+    "fmt"
+    "log"
+    "net/http"
+)
+
+// requestIDHeader carries the request ID in both directions.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen bounds a client-supplied ID; longer or oddly formed ones
+// are replaced rather than copied into logs.
+const maxRequestIDLen = 128
+
+// RequestID tags each request with an ID: the client's X-Request-ID when it
+// is well formed, otherwise a new random UUID. The ID is stored in the request
+// context and echoed in the response header before next runs, so every log
+// line and error body for the request can carry it.
+func RequestID(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        id := r.Header.Get(requestIDHeader)
+        if !validRequestID(id) {
+            id = newUUID()
+        }
+        w.Header().Set(requestIDHeader, id)
+        next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDCtxKey, id)))
+    })
+}
+
+// RequestIDFromContext returns the ID RequestID assigned, or "" outside a
+// request.
+func RequestIDFromContext(ctx context.Context) string {
+    id, _ := ctx.Value(requestIDCtxKey).(string)
+    return id
+}
+
+func validRequestID(id string) bool {
+    if id == "" || len(id) > maxRequestIDLen {
+        return false
+    }
+    for _, c := range id {
+        switch {
+        case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.', c == ':':
+        default:
+            return false
+        }
+    }
+    return true
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+    var b [16]byte
+    rand.Read(b[:])
+    b[6] = b[6]&0x0f | 0x40
+    b[8] = b[8]&0x3f | 0x80
+    return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// logRequest logs a line tagged with a request ID.
+func logRequest(id, format string, args ...any) {
+    log.Printf("[%s] "+format, append([]any{id}, args...)...)
+}
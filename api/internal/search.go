@@ -0,0 +1,93 @@
+package internal
+
+import (
+    "context"
+    "net/http"
+    "strings"
+)
+
+const (
+    defaultSearchLimit = 10
+    maxSearchLimit     = 50
+)
+
+// searchHit is one search result; Type says which resource Data holds.
+type searchHit struct {
+    Type string `json:"type"`
+    Data any    `json:"data"`
+}
+
+// searchResult is the Search response. Warnings names the resources that
+// couldn't be searched, so Data may be partial.
+type searchResult struct {
+    Data     []searchHit `json:"data"`
+    Warnings []string    `json:"warnings,omitempty"`
+}
+
+// Search looks for ?q= in customer names, emails and phones and in case
+// titles, returning up to ?limit= hits of each type (default 10, at most
+// 50), customers first. The two lookups are independent: if one fails its
+// hits are left out and a warning is added instead, and only when both fail
+// is the request an error.
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
+    q := strings.TrimSpace(r.URL.Query().Get("q"))
+    if q == "" {
+        writeError(w, 400, CodeInvalidParameter, "q is required")
+        return
+    }
+    limit, err := queryInt(r, "limit", defaultSearchLimit)
+    if err != nil {
+        writeError(w, 400, CodeInvalidParameter, err.Error())
+        return
+    }
+    limit = min(max(limit, 1), maxSearchLimit)
+
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+    id := RequestIDFromContext(r.Context())
+
+    res := searchResult{Data: []searchHit{}}
+    customers, cerr := h.Customers.List(ctx, CustomerFilter{Query: q, Limit: limit})
+    if cerr != nil {
+        logRequest(id, "search customers: %v", cerr)
+        res.Warnings = append(res.Warnings, "customers could not be searched")
+    }
+    for _, c := range customers {
+        res.Data = append(res.Data, searchHit{Type: "customer", Data: c})
+    }
+
+    cases, kerr := h.searchCases(ctx, q, limit)
+    if kerr != nil {
+        logRequest(id, "search cases: %v", kerr)
+        res.Warnings = append(res.Warnings, "cases could not be searched")
+    }
+    for _, c := range cases {
+        res.Data = append(res.Data, searchHit{Type: "case", Data: c})
+    }
+
+    if cerr != nil && kerr != nil {
+        dbError(w, cerr)
+        return
+    }
+    writeJSON(w, http.StatusOK, res)
+}
+
+// searchCases returns up to limit cases whose title contains q, newest first.
+func (h *Handler) searchCases(ctx context.Context, q string, limit int) ([]Case, error) {
+    rows, err := h.ReaderDB().QueryContext(ctx, `SELECT `+caseColumns+` FROM cases WHERE org_id = ? AND title `+dialect.like()+` ? ORDER BY id DESC LIMIT ?`,
+        orgFromContext(ctx), "%"+likeEscaper.Replace(q)+"%", limit)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var out []Case
+    for rows.Next() {
+        c, err := scanCase(rows)
+        if err != nil {
+            return nil, err
+        }
+        out = append(out, c)
+    }
+    return out, rows.Err()
+}
@@ -0,0 +1,147 @@
+package internal
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+
+    "golang.org/x/sync/errgroup"
+    "golang.org/x/sync/singleflight"
+)
+
+// Stats is the dashboard summary served by GET /api/stats.
+type Stats struct {
+    Customers           int            `json:"customers"`
+    CustomersLast7Days  int            `json:"customers_last_7_days"`
+    CustomersLast30Days int            `json:"customers_last_30_days"`
+    CasesByStatus       map[string]int `json:"cases_by_status"`
+    // AvgOpenCaseAgeSeconds is the mean age of the cases not yet closed.
+    AvgOpenCaseAgeSeconds float64   `json:"avg_open_case_age_seconds"`
+    GeneratedAt           time.Time `json:"generated_at"`
+}
+
+// statsCache holds the last Stats computed for each org, so dashboards
+// polling /api/stats cost at most one round of queries per org per TTL.
+// Concurrent computations for an org are shared through group, so a burst of
+// misses or refreshes queries once. The zero value is empty.
+type statsCache struct {
+    mu      sync.Mutex
+    entries map[int]statsEntry
+    group   singleflight.Group
+}
+
+type statsEntry struct {
+    stats   Stats
+    expires time.Time
+}
+
+// Stats returns the caller's org's dashboard counts: live customers in total
+// and created in the last 7 and 30 days, cases per status, and the average
+// age of open cases. The queries run concurrently and the result is cached
+// for Config.StatsCacheTTL, so the numbers may be that much behind
+// (generated_at says when they were taken).
+func (h *Handler) Stats(w http.ResponseWriter, r *http.Request) {
+    org := orgFromContext(r.Context())
+    h.stats.mu.Lock()
+    e, ok := h.stats.entries[org]
+    h.stats.mu.Unlock()
+    if ok && time.Now().Before(e.expires) {
+        writeJSON(w, http.StatusOK, e.stats)
+        return
+    }
+    h.writeFreshStats(w, r)
+}
+
+// RefreshStats recomputes the caller's org's stats now, replacing the cached
+// entry, and returns them; useful after a bulk import rather than waiting
+// out the TTL. Calls that overlap share one computation.
+func (h *Handler) RefreshStats(w http.ResponseWriter, r *http.Request) {
+    h.writeFreshStats(w, r)
+}
+
+func (h *Handler) writeFreshStats(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+    st, err := h.refreshStats(ctx, orgFromContext(ctx), h.queryTimeout(r))
+    if err != nil {
+        dbError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, st)
+}
+
+// refreshStats computes org's stats and caches them. A caller arriving while
+// a computation for org is running waits for that one instead of starting
+// another. The computation runs detached from the caller that started it,
+// under its own timeout, so that caller disconnecting or running out of time
+// doesn't fail the others; each caller stops waiting when its own ctx ends.
+func (h *Handler) refreshStats(ctx context.Context, org int, timeout time.Duration) (Stats, error) {
+    ch := h.stats.group.DoChan(strconv.Itoa(org), func() (any, error) {
+        ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+        defer cancel()
+        st, err := h.computeStats(ctx, org)
+        if err != nil {
+            return nil, err
+        }
+        h.stats.mu.Lock()
+        defer h.stats.mu.Unlock()
+        if h.stats.entries == nil {
+            h.stats.entries = map[int]statsEntry{}
+        }
+        h.stats.entries[org] = statsEntry{stats: st, expires: time.Now().Add(h.Config.StatsCacheTTL)}
+        return st, nil
+    })
+    select {
+    case res := <-ch:
+        if res.Err != nil {
+            return Stats{}, res.Err
+        }
+        return res.Val.(Stats), nil
+    case <-ctx.Done():
+        return Stats{}, ctx.Err()
+    }
+}
+
+func (h *Handler) computeStats(ctx context.Context, org int) (Stats, error) {
+    db := h.ReaderDB()
+    st := Stats{CasesByStatus: map[string]int{}, GeneratedAt: time.Now().UTC()}
+    for s := range caseStatuses {
+        st.CasesByStatus[s] = 0
+    }
+
+    g, ctx := errgroup.WithContext(ctx)
+    g.Go(func() error {
+        return db.QueryRowContext(ctx, `SELECT COUNT(*),
+                COALESCE(SUM(CASE WHEN created_at >= `+dialect.secondsAgo()+` THEN 1 ELSE 0 END), 0),
+                COALESCE(SUM(CASE WHEN created_at >= `+dialect.secondsAgo()+` THEN 1 ELSE 0 END), 0)
+            FROM customers WHERE org_id = ? AND deleted_at IS NULL`, 7*24*3600, 30*24*3600, org).
+            Scan(&st.Customers, &st.CustomersLast7Days, &st.CustomersLast30Days)
+    })
+    // Each goroutine writes only its own fields of st.
+    g.Go(func() error {
+        rows, err := db.QueryContext(ctx, `SELECT status, COUNT(*) FROM cases WHERE org_id = ? GROUP BY status`, org)
+        if err != nil {
+            return err
+        }
+        defer rows.Close()
+        for rows.Next() {
+            var status string
+            var n int
+            if err := rows.Scan(&status, &n); err != nil {
+                return err
+            }
+            st.CasesByStatus[status] = n
+        }
+        return rows.Err()
+    })
+    g.Go(func() error {
+        return db.QueryRowContext(ctx, `SELECT COALESCE(AVG(`+dialect.ageSeconds("created_at")+`), 0)
+            FROM cases WHERE org_id = ? AND status <> 'closed'`, org).Scan(&st.AvgOpenCaseAgeSeconds)
+    })
+    if err := g.Wait(); err != nil {
+        return Stats{}, err
+    }
+    return st, nil
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+    "context"
+    "database/sql/driver"
+    "errors"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestRefreshStatsOutlivesFirstCaller(t *testing.T) {
+    started, release := make(chan struct{}), make(chan struct{})
+    db, fake := newFakeDB(t, func(query string, args []driver.Value) fakeResult {
+        if strings.HasPrefix(query, "SELECT COUNT(*),") {
+            close(started)
+            <-release
+        }
+        return ownerOrgData(query, args)
+    })
+    h := newTestHandler(t, db)
+
+    type result struct {
+        st  Stats
+        err error
+    }
+    firstCtx, cancelFirst := context.WithCancel(context.Background())
+    first, second := make(chan result, 1), make(chan result, 1)
+    go func() {
+        st, err := h.refreshStats(firstCtx, 1, time.Minute)
+        first <- result{st, err}
+    }()
+    <-started
+    go func() {
+        st, err := h.refreshStats(context.Background(), 1, time.Minute)
+        second <- result{st, err}
+    }()
+    // Give the second caller time to join the running computation.
+    time.Sleep(20 * time.Millisecond)
+
+    // The first caller leaves without waiting for the queries.
+    cancelFirst()
+    select {
+    case res := <-first:
+        if !errors.Is(res.err, context.Canceled) {
+            t.Errorf("first caller: got %v, want context.Canceled", res.err)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("first caller still waiting after its context was cancelled")
+    }
+
+    close(release)
+    res := <-second
+    if res.err != nil {
+        t.Fatalf("second caller: %v", res.err)
+    }
+    if res.st.Customers != 1 {
+        t.Errorf("second caller: %d customers, want 1", res.st.Customers)
+    }
+    h.stats.mu.Lock()
+    _, cached := h.stats.entries[1]
+    h.stats.mu.Unlock()
+    if !cached {
+        t.Error("the shared result wasn't cached")
+    }
+
+    var runs int
+    for _, st := range fake.Statements() {
+        if strings.HasPrefix(st.Query, "SELECT COUNT(*),") {
+            runs++
+        }
+    }
+    if runs != 1 {
+        t.Errorf("stats computed %d times, want once", runs)
+    }
+}
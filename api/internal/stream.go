@@ -0,0 +1,141 @@
+package internal
+
+import (
+    "fmt"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+)
+
+const (
+    // sseKeepAlive is how often an idle event stream gets a comment line, so
+    // proxies don't close it.
+    sseKeepAlive = 15 * time.Second
+    // sseBuffer is how many events a subscriber may fall behind by before
+    // it is disconnected; its client reconnects and carries on.
+    sseBuffer = 16
+)
+
+// caseBroker fans newly created cases out to the open event streams of the
+// org they belong to. The zero value has no subscribers and is ready to use.
+type caseBroker struct {
+    mu     sync.Mutex
+    subs   map[chan Case]int // subscriber -> org
+    closed bool
+}
+
+// subscribe registers a new subscriber to org's cases, or returns false
+// when max are already connected or the broker is closed. max counts
+// subscribers across all orgs.
+func (b *caseBroker) subscribe(max, org int) (chan Case, bool) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if b.closed || len(b.subs) >= max {
+        return nil, false
+    }
+    if b.subs == nil {
+        b.subs = map[chan Case]int{}
+    }
+    ch := make(chan Case, sseBuffer)
+    b.subs[ch] = org
+    return ch, true
+}
+
+// unsubscribe removes ch, closing it unless publish or close already has.
+func (b *caseBroker) unsubscribe(ch chan Case) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if _, ok := b.subs[ch]; ok {
+        delete(b.subs, ch)
+        close(ch)
+    }
+}
+
+// publish sends c to every subscriber of org without blocking; one whose
+// buffer is full is dropped.
+func (b *caseBroker) publish(org int, c Case) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    for ch, o := range b.subs {
+        if o != org {
+            continue
+        }
+        select {
+        case ch <- c:
+        default:
+            delete(b.subs, ch)
+            close(ch)
+        }
+    }
+}
+
+// close ends every stream and refuses new ones.
+func (b *caseBroker) close() {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    b.closed = true
+    for ch := range b.subs {
+        delete(b.subs, ch)
+        close(ch)
+    }
+}
+
+// CloseStreams ends every open event stream so a graceful shutdown isn't
+// held up by them; register it with http.Server.RegisterOnShutdown.
+func (h *Handler) CloseStreams() {
+    h.caseEvents.close()
+}
+
+// StreamCases holds a Server-Sent Events stream that sends a "case.created"
+// event, with the case as its data, for every case created in the caller's
+// org after the client connects. An idle stream gets a keep-alive comment
+// every sseKeepAlive. At most Config.SSEMaxSubscribers streams are open at
+// once; past that the client gets a 503 and should retry later.
+func (h *Handler) StreamCases(w http.ResponseWriter, r *http.Request) {
+    rc := http.NewResponseController(w)
+    events, ok := h.caseEvents.subscribe(h.Config.SSEMaxSubscribers, orgFromContext(r.Context()))
+    if !ok {
+        w.Header().Set("Retry-After", strconv.Itoa(int(sseKeepAlive.Seconds())))
+        writeError(w, http.StatusServiceUnavailable, CodeUnavailable, "too many open event streams")
+        return
+    }
+    defer h.caseEvents.unsubscribe(events)
+
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.Header().Set("X-Accel-Buffering", "no")
+    w.WriteHeader(http.StatusOK)
+    if err := rc.Flush(); err != nil {
+        return
+    }
+
+    ping := time.NewTicker(sseKeepAlive)
+    defer ping.Stop()
+    for {
+        select {
+        case <-r.Context().Done():
+            return
+        case c, ok := <-events:
+            if !ok {
+                return
+            }
+            data, err := encodeAs(w, mediaJSON, c)
+            if err != nil {
+                logRequest(RequestIDFromContext(r.Context()), "stream cases: %v", err)
+                continue
+            }
+            // encodeAs ends data with a newline; one more ends the event.
+            if _, err := fmt.Fprintf(w, "event: case.created\nid: %d\ndata: %s\n", c.ID, data); err != nil {
+                return
+            }
+        case <-ping.C:
+            if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+                return
+            }
+        }
+        if err := rc.Flush(); err != nil {
+            return
+        }
+    }
+}
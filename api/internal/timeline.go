@@ -0,0 +1,155 @@
+package internal
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "net/http"
+    "sort"
+    "strconv"
+    "time"
+
+    "golang.org/x/sync/errgroup"
+)
+
+// timelineItem is one event on a customer's timeline; Type says which
+// resource Data holds and At is when it happened.
+type timelineItem struct {
+    Type string    `json:"type"`
+    At   time.Time `json:"at"`
+    Data any       `json:"data"`
+}
+
+// timelinePage is the CustomerTimeline response envelope.
+type timelinePage struct {
+    Data     []timelineItem `json:"data"`
+    Limit    int            `json:"limit"`
+    Offset   int            `json:"offset"`
+    Total    int            `json:"total"`
+    MaxLimit int            `json:"max_limit"`
+}
+
+// timelineSource is one of the queries a timeline is merged from. count and
+// list take the customer id; list also takes a row limit and must return
+// rows newest first.
+type timelineSource struct {
+    kind        string
+    count, list string
+    scan        func(rowScanner) (any, *time.Time, error)
+}
+
+var timelineSources = []timelineSource{
+    {
+        kind:  "case",
+        count: `SELECT COUNT(*) FROM cases WHERE customer_id = ?`,
+        list:  `SELECT ` + caseColumns + ` FROM cases WHERE customer_id = ? ORDER BY created_at DESC, id DESC LIMIT ?`,
+        scan: func(row rowScanner) (any, *time.Time, error) {
+            c, err := scanCase(row)
+            return c, c.CreatedAt, err
+        },
+    },
+    {
+        kind: "comment",
+        count: `SELECT COUNT(*) FROM case_comments cc JOIN cases c ON c.id = cc.case_id WHERE c.customer_id = ?`,
+        list: `SELECT cc.id, cc.case_id, cc.author, cc.body, cc.created_at FROM case_comments cc
+            JOIN cases c ON c.id = cc.case_id WHERE c.customer_id = ? ORDER BY cc.created_at DESC, cc.id DESC LIMIT ?`,
+        scan: func(row rowScanner) (any, *time.Time, error) {
+            c, err := scanComment(row)
+            return c, c.CreatedAt, err
+        },
+    },
+    {
+        kind:  "audit",
+        count: `SELECT COUNT(*) FROM audit_log WHERE entity = 'customer' AND entity_id = ?`,
+        list:  `SELECT ` + auditColumns + ` FROM audit_log WHERE entity = 'customer' AND entity_id = ? ORDER BY id DESC LIMIT ?`,
+        scan: func(row rowScanner) (any, *time.Time, error) {
+            e, err := scanAudit(row)
+            return e, e.CreatedAt, err
+        },
+    },
+}
+
+// CustomerTimeline returns a customer's cases, the comments on those cases
+// and the customer's audit entries as one list, newest first, each item
+// tagged with its type. The sources are queried concurrently and merged
+// here, so each one reads offset+limit rows; paging and ?envelope= work as
+// in ListCustomers. An unknown customer is 404.
+func (h *Handler) CustomerTimeline(w http.ResponseWriter, r *http.Request) {
+    id, ok := customerID(w, r)
+    if !ok {
+        return
+    }
+    pl := h.pageLimits("timeline")
+    limit, offset, err := pl.parse(r)
+    if err != nil {
+        writeError(w, 400, CodeInvalidParameter, err.Error())
+        return
+    }
+    shape, err := parsePageShape(r)
+    if err != nil {
+        writeError(w, 400, CodeInvalidParameter, err.Error())
+        return
+    }
+
+    ctx, cancel := h.dbContext(r)
+    defer cancel()
+
+    if _, err := h.Customers.Get(ctx, id); err != nil {
+        customerError(w, err)
+        return
+    }
+
+    // Each goroutine writes only its own slot.
+    items := make([][]timelineItem, len(timelineSources))
+    totals := make([]int, len(timelineSources))
+    g, gctx := errgroup.WithContext(ctx)
+    for i, src := range timelineSources {
+        g.Go(func() error {
+            var err error
+            items[i], totals[i], err = src.read(gctx, h.ReaderDB(), id, offset+limit)
+            return err
+        })
+    }
+    if err := g.Wait(); err != nil {
+        dbError(w, err)
+        return
+    }
+
+    page := timelinePage{Data: []timelineItem{}, Limit: limit, Offset: offset, MaxLimit: pl.Max}
+    for i := range timelineSources {
+        page.Data = append(page.Data, items[i]...)
+        page.Total += totals[i]
+    }
+    sort.SliceStable(page.Data, func(i, j int) bool { return page.Data[i].At.After(page.Data[j].At) })
+    page.Data = page.Data[min(offset, len(page.Data)):min(offset+limit, len(page.Data))]
+
+    w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+    writeJSON(w, http.StatusOK, shapePage(shape, page, page.Data, pl.meta(limit, offset, page.Total)))
+}
+
+// read returns the newest n items of src for customer id, and how many it
+// has in all.
+func (src timelineSource) read(ctx context.Context, db *sql.DB, id, n int) ([]timelineItem, int, error) {
+    var total int
+    if err := db.QueryRowContext(ctx, src.count, id).Scan(&total); err != nil {
+        return nil, 0, err
+    }
+    rows, err := db.QueryContext(ctx, src.list, id, n)
+    if err != nil {
+        return nil, 0, err
+    }
+    defer rows.Close()
+
+    var out []timelineItem
+    for rows.Next() {
+        data, at, err := src.scan(rows)
+        if err != nil {
+            return nil, 0, err
+        }
+        if at == nil {
+            return nil, 0, errors.New("timeline: " + src.kind + " row without a timestamp")
+        }
+        out = append(out, timelineItem{Type: src.kind, At: *at, Data: data})
+    }
+    return out, total, rows.Err()
+}
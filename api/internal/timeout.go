@@ -0,0 +1,119 @@
+package internal
+
+import (
+    "context"
+    "net/http"
+    "sync"
+    "time"
+)
+
+// streamingPaths hold their response open by design, so Timeout leaves them
+// alone; they end when the client disconnects or the server shuts down.
+var streamingPaths = map[string]bool{
+    "/api/cases/stream": true,
+}
+
+// Timeout bounds each request to d of wall-clock time. The handler runs with
+// a context that is cancelled at the deadline, so database calls made with
+// it abort and release their connections. If the handler hasn't started its
+// response by then the client gets a 503, and anything the handler writes
+// afterwards is discarded; a response already under way is left to finish
+// once its context is cancelled.
+func Timeout(next http.Handler, d time.Duration) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if streamingPaths[r.URL.Path] {
+            next.ServeHTTP(w, r)
+            return
+        }
+        ctx, cancel := context.WithTimeout(r.Context(), d)
+        defer cancel()
+
+        tw := &timeoutWriter{w: w, h: w.Header().Clone()}
+        done := make(chan struct{})
+        panicked := make(chan any, 1)
+        go func() {
+            defer func() {
+                if v := recover(); v != nil {
+                    panicked <- v
+                }
+                close(done)
+            }()
+            next.ServeHTTP(tw, r.WithContext(ctx))
+        }()
+
+        select {
+        case <-done:
+            select {
+            case v := <-panicked:
+                // Re-raise on the serving goroutine so net/http sees it.
+                panic(v)
+            default:
+            }
+        case <-ctx.Done():
+            tw.mu.Lock()
+            started := tw.wroteHeader
+            if !started {
+                tw.timedOut = true
+                writeError(w, http.StatusServiceUnavailable, CodeTimeout, "the request took too long to process")
+            }
+            tw.mu.Unlock()
+            if started {
+                <-done
+            }
+        }
+    })
+}
+
+// timeoutWriter serializes the handler's writes with Timeout's own 503, and
+// discards the handler's writes once that has been sent. The handler gets its
+// own header map, copied to the real one when the response starts, so a late
+// handler can't race Timeout on it.
+type timeoutWriter struct {
+    w  http.ResponseWriter
+    h  http.Header
+    mu sync.Mutex
+
+    wroteHeader bool
+    timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header { return tw.h }
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+    tw.mu.Lock()
+    defer tw.mu.Unlock()
+    tw.writeHeaderLocked(status)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(status int) {
+    if tw.timedOut || tw.wroteHeader {
+        return
+    }
+    tw.wroteHeader = true
+    dst := tw.w.Header()
+    for k, v := range tw.h {
+        dst[k] = v
+    }
+    tw.w.WriteHeader(status)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+    tw.mu.Lock()
+    defer tw.mu.Unlock()
+    if tw.timedOut {
+        return 0, http.ErrHandlerTimeout
+    }
+    tw.writeHeaderLocked(http.StatusOK)
+    return tw.w.Write(b)
+}
+
+// Flush lets streaming handlers push data through the middleware.
+func (tw *timeoutWriter) Flush() {
+    tw.mu.Lock()
+    defer tw.mu.Unlock()
+    if tw.timedOut {
+        return
+    }
+    tw.writeHeaderLocked(http.StatusOK)
+    http.NewResponseController(tw.w).Flush()
+}
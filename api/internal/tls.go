@@ -0,0 +1,20 @@
+package internal
+
+import "crypto/tls"
+
+// ServerTLSConfig is the TLS configuration used when the API terminates TLS
+// itself: TLS 1.2 at minimum, and for 1.2 only forward-secret AEAD suites.
+// TLS 1.3 suites aren't configurable and are all sound.
+func ServerTLSConfig() *tls.Config {
+    return &tls.Config{
+        MinVersion: tls.VersionTLS12,
+        CipherSuites: []uint16{
+            tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+            tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+            tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+            tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+            tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+            tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+        },
+    }
+}
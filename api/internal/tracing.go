@@ -0,0 +1,75 @@
+package internal
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+
+    "github.com/gorilla/mux"
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+    "go.opentelemetry.io/otel/propagation"
+    "go.opentelemetry.io/otel/sdk/resource"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    "go.opentelemetry.io/otel/trace"
+)
+
+// tracer is set by InitTracing when an OTLP endpoint is configured. While it
+// is nil neither requests nor queries are traced, and Trace and the DB
+// wrapper add nothing to them.
+var tracer trace.Tracer
+
+// InitTracing exports spans over OTLP/HTTP to Config.OTLPEndpoint and
+// returns a function that flushes and stops the exporter. With no endpoint
+// it does nothing. It must run before OpenDB so queries are traced. The
+// service name and other resource attributes come from the standard
+// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES.
+func InitTracing(ctx context.Context, cfg *Config) (func(context.Context) error, error) {
+    if cfg.OTLPEndpoint == "" {
+        return func(context.Context) error { return nil }, nil
+    }
+    exp, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.OTLPEndpoint))
+    if err != nil {
+        return nil, fmt.Errorf("otlp exporter: %w", err)
+    }
+    tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(resource.Default()))
+    otel.SetTracerProvider(tp)
+    otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+    tracer = tp.Tracer("example.com/api")
+    return tp.Shutdown, nil
+}
+
+// Trace starts a server span for each request, continuing the trace of an
+// incoming traceparent header, named by the method and mux route template
+// like Instrument's labels. Handlers and queries run under it, so DB spans
+// are its children. Without tracing it returns next unchanged.
+func Trace(next http.Handler, router *mux.Router) http.Handler {
+    if tracer == nil {
+        return next
+    }
+    prop := otel.GetTextMapPropagator()
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        route := routeTemplate(router, r)
+        ctx := prop.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+        ctx, span := tracer.Start(ctx, r.Method+" "+route,
+            trace.WithSpanKind(trace.SpanKindServer),
+            trace.WithAttributes(
+                attribute.String("http.request.method", r.Method),
+                attribute.String("http.route", route),
+                attribute.String("url.path", r.URL.Path),
+            ))
+        defer span.End()
+
+        rw := &responseWriter{ResponseWriter: w}
+        next.ServeHTTP(rw, r.WithContext(ctx))
+        if rw.status == 0 {
+            rw.status = http.StatusOK
+        }
+        span.SetAttributes(attribute.Int("http.response.status_code", rw.status))
+        if rw.status >= 500 {
+            span.SetStatus(codes.Error, http.StatusText(rw.status))
+        }
+    })
+}
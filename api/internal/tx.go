@@ -0,0 +1,85 @@
+package internal
+
+import (
+    "context"
+    "database/sql"
+    "math/rand/v2"
+    "time"
+)
+
+// txRetryBaseDelay is the backoff before the first retry of a transaction;
+// it doubles on each later attempt and is jittered by ±50%.
+const txRetryBaseDelay = 20 * time.Millisecond
+
+// withRetry runs fn in a transaction and commits it, unless ctx is
+// validate-only (see withValidateOnly). When the transaction
+// fails with a deadlock or lock wait timeout it is rolled back and run again,
+// up to attempts times in all, after a short jittered backoff. fn must not
+// have effects outside tx, since it may run more than once.
+func withRetry(ctx context.Context, db *sql.DB, attempts int, fn func(tx *sql.Tx) error) error {
+    delay := txRetryBaseDelay
+    for attempt := 1; ; attempt++ {
+        err := runTx(ctx, db, fn)
+        if err == nil || attempt >= attempts || !isRetryable(err) {
+            return err
+        }
+        jitter := time.Duration(rand.Int64N(int64(delay)))
+        select {
+        case <-time.After(delay/2 + jitter):
+        case <-ctx.Done():
+            return err
+        }
+        delay *= 2
+    }
+}
+
+// WithTx runs fn in one transaction on the primary under ctx, committing if
+// it returns nil and rolling back if it returns an error or panics; see
+// withRetry for the deadlock retries, which fn must tolerate.
+func (h *Handler) WithTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+    return withRetry(ctx, h.WriterDB(), h.Config.DBTxAttempts, fn)
+}
+
+// WithTx is Handler.WithTx for the repo's own writes.
+func (r *CustomerRepo) WithTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+    return withRetry(ctx, r.db, r.txAttempts, fn)
+}
+
+// runTx runs one attempt of fn. The deferred Rollback also runs while a
+// panic from fn unwinds, so a panicking fn commits nothing; once Commit has
+// succeeded the Rollback is a no-op.
+func runTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+    tx, err := db.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if err := fn(tx); err != nil {
+        return err
+    }
+    if isValidateOnly(ctx) {
+        return nil
+    }
+    return tx.Commit()
+}
+
+// withValidateOnly marks ctx so transactions run under it are rolled back
+// instead of committed: every statement and constraint check still runs, but
+// nothing is kept.
+func withValidateOnly(ctx context.Context) context.Context {
+    return context.WithValue(ctx, validateOnlyCtxKey, true)
+}
+
+func isValidateOnly(ctx context.Context) bool {
+    v, _ := ctx.Value(validateOnlyCtxKey).(bool)
+    return v
+}
+
+// isRetryable reports whether err is a deadlock or lock wait timeout, after
+// which the database has rolled back and the transaction can simply be run
+// again.
+func isRetryable(err error) bool {
+    k := dialect.classify(err)
+    return k == dbErrDeadlock || k == dbErrLockTimeout
+}
@@ -0,0 +1,139 @@
+package internal
+
+import (
+    "context"
+    "database/sql"
+    "database/sql/driver"
+    "errors"
+    "strings"
+    "testing"
+
+    "github.com/go-sql-driver/mysql"
+)
+
+// threeInserts runs the inserts of a three-step write in tx.
+func threeInserts(ctx context.Context, tx *sql.Tx) error {
+    for _, table := range []string{"customers", "cases", "comments"} {
+        if _, err := tx.ExecContext(ctx, "INSERT INTO "+table+" (id) VALUES (?)", 1); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// failing answers statements on table with err and everything else with
+// one affected row.
+func failing(table string, err error) func(string, []driver.Value) fakeResult {
+    return func(query string, _ []driver.Value) fakeResult {
+        if strings.HasPrefix(query, "INSERT INTO "+table+" ") {
+            return fakeResult{err: err}
+        }
+        return fakeResult{affected: 1}
+    }
+}
+
+func TestWithTx(t *testing.T) {
+    errBoom := errors.New("boom")
+    for _, tc := range []struct {
+        name       string
+        respond    func(string, []driver.Value) fakeResult
+        ctx        context.Context
+        err        error
+        statements int
+        commits    int
+        rollbacks  int
+    }{
+        {"all succeed", nil, context.Background(), nil, 3, 1, 0},
+        {"second fails", failing("cases", errBoom), context.Background(), errBoom, 2, 0, 1},
+        {"last fails", failing("comments", errBoom), context.Background(), errBoom, 3, 0, 1},
+        {"validate only", nil, withValidateOnly(context.Background()), nil, 3, 0, 1},
+    } {
+        db, fake := newFakeDB(t, tc.respond)
+        h := &Handler{DB: db, Config: &Config{DBTxAttempts: 3}}
+        err := h.WithTx(tc.ctx, func(tx *sql.Tx) error { return threeInserts(tc.ctx, tx) })
+        if !errors.Is(err, tc.err) {
+            t.Errorf("%s: got %v, want %v", tc.name, err, tc.err)
+        }
+        stmts := fake.Statements()
+        if len(stmts) != tc.statements {
+            t.Errorf("%s: ran %d statements, want %d", tc.name, len(stmts), tc.statements)
+        }
+        for _, st := range stmts {
+            if !st.InTx {
+                t.Errorf("%s: %q ran outside the transaction", tc.name, st.Query)
+            }
+        }
+        if commits, rollbacks := fake.Ended(); commits != tc.commits || rollbacks != tc.rollbacks {
+            t.Errorf("%s: %d commits, %d rollbacks; want %d, %d", tc.name, commits, rollbacks, tc.commits, tc.rollbacks)
+        }
+    }
+}
+
+func TestWithTxPanic(t *testing.T) {
+    db, fake := newFakeDB(t, nil)
+    h := &Handler{DB: db, Config: &Config{DBTxAttempts: 3}}
+    func() {
+        defer func() {
+            if v := recover(); v != "boom" {
+                t.Errorf("recovered %v, want the panic passed on", v)
+            }
+        }()
+        h.WithTx(context.Background(), func(tx *sql.Tx) error {
+            if _, err := tx.Exec("INSERT INTO customers (id) VALUES (?)", 1); err != nil {
+                return err
+            }
+            panic("boom")
+        })
+    }()
+    if commits, rollbacks := fake.Ended(); commits != 0 || rollbacks != 1 {
+        t.Errorf("%d commits, %d rollbacks; want 0, 1", commits, rollbacks)
+    }
+
+    // The connection went back to the pool usable.
+    if err := h.WithTx(context.Background(), func(tx *sql.Tx) error {
+        return threeInserts(context.Background(), tx)
+    }); err != nil {
+        t.Fatal(err)
+    }
+    if commits, _ := fake.Ended(); commits != 1 {
+        t.Errorf("%d commits after the panic, want 1", commits)
+    }
+}
+
+func TestWithTxRetriesDeadlock(t *testing.T) {
+    deadlocks := 1
+    db, fake := newFakeDB(t, func(query string, _ []driver.Value) fakeResult {
+        if strings.HasPrefix(query, "INSERT INTO cases ") && deadlocks > 0 {
+            deadlocks--
+            return fakeResult{err: &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}}
+        }
+        return fakeResult{affected: 1}
+    })
+    h := &Handler{DB: db, Config: &Config{DBTxAttempts: 3}}
+    attempts := 0
+    err := h.WithTx(context.Background(), func(tx *sql.Tx) error {
+        attempts++
+        return threeInserts(context.Background(), tx)
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if attempts != 2 {
+        t.Errorf("%d attempts, want 2", attempts)
+    }
+    if commits, rollbacks := fake.Ended(); commits != 1 || rollbacks != 1 {
+        t.Errorf("%d commits, %d rollbacks; want 1, 1", commits, rollbacks)
+    }
+
+    // Anything else isn't retried.
+    attempts = 0
+    db, _ = newFakeDB(t, failing("cases", &mysql.MySQLError{Number: 1062}))
+    h.DB = db
+    err = h.WithTx(context.Background(), func(tx *sql.Tx) error {
+        attempts++
+        return threeInserts(context.Background(), tx)
+    })
+    if !isDuplicateKey(err) || attempts != 1 {
+        t.Errorf("got %v after %d attempts, want the duplicate key after 1", err, attempts)
+    }
+}
@@ -0,0 +1,165 @@
+package internal
+
+import (
+    "errors"
+    "fmt"
+    "mime"
+    "net/http"
+    "reflect"
+    "regexp"
+    "strconv"
+    "strings"
+
+    "github.com/go-playground/validator/v10"
+)
+
+// validate checks the `validate` struct tags on request payloads. Fields are
+// reported by their JSON names.
+var validate = func() *validator.Validate {
+    v := validator.New(validator.WithRequiredStructEnabled())
+    v.RegisterTagNameFunc(func(f reflect.StructField) string {
+        name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+        if name == "-" {
+            return ""
+        }
+        return name
+    })
+    for tag, n := range lengthTags {
+        v.RegisterAlias(tag, "max="+strconv.Itoa(n))
+    }
+    // mediatype accepts a MIME type such as "application/pdf".
+    v.RegisterValidation("mediatype", func(fl validator.FieldLevel) bool {
+        _, _, err := mime.ParseMediaType(fl.Field().String())
+        return err == nil
+    })
+    // phone accepts an E.164 number: "+", a country code that doesn't
+    // start with 0, and at most 15 digits in all.
+    v.RegisterValidation("phone", func(fl validator.FieldLevel) bool {
+        return e164Pattern.MatchString(fl.Field().String())
+    })
+    // jsonobject accepts a decoded json.RawMessage holding an object; see
+    // isMetadataObject.
+    v.RegisterValidation("jsonobject", func(fl validator.FieldLevel) bool {
+        return isMetadataObject(fl.Field().Bytes())
+    })
+    return v
+}()
+
+var e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// fieldError is one failed constraint, as listed in a 400's "details".
+type fieldError struct {
+    Field   string `json:"field"`
+    Message string `json:"message"`
+}
+
+// validationError lists every field of a payload that failed validation.
+type validationError []fieldError
+
+func (e validationError) Error() string {
+    msgs := make([]string, len(e))
+    for i, fe := range e {
+        msgs[i] = fe.Message
+    }
+    return strings.Join(msgs, "; ")
+}
+
+// validateStruct checks v's `validate` tags, returning a validationError
+// naming every failing field, or nil.
+func validateStruct(v any) error {
+    err := validate.Struct(v)
+    var ves validator.ValidationErrors
+    if !errors.As(err, &ves) {
+        return err
+    }
+    out := make(validationError, len(ves))
+    for i, fe := range ves {
+        out[i] = fieldError{Field: fe.Field(), Message: fieldMessage(fe)}
+    }
+    return out
+}
+
+// fieldMessage words a failed constraint for clients. A lengthTags alias
+// reads as the max= it stands for.
+func fieldMessage(fe validator.FieldError) string {
+    f := fe.Field()
+    switch fe.ActualTag() {
+    case "required":
+        return f + " is required"
+    case "max":
+        if fe.Kind() == reflect.String {
+            return fmt.Sprintf("%s must be at most %s characters", f, fe.Param())
+        }
+        return fmt.Sprintf("%s must be at most %s", f, fe.Param())
+    case "min":
+        if fe.Kind() == reflect.Slice && fe.Param() == "1" {
+            return f + " must not be empty"
+        }
+        if fe.Kind() == reflect.Slice {
+            return fmt.Sprintf("%s must list at least %s items", f, fe.Param())
+        }
+        return fmt.Sprintf("%s must be at least %s", f, fe.Param())
+    case "oneof":
+        return f + " must be one of " + strings.ReplaceAll(fe.Param(), " ", ", ")
+    case "email":
+        return f + " is not a valid address"
+    case "jsonobject":
+        return fmt.Sprintf("%s must be a JSON object of at most %d bytes", f, maxCaseMetadataBytes)
+    case "phone":
+        return f + " must be an international number, like +14155550123"
+    case "http_url":
+        return f + " must be an absolute http or https URL"
+    case "mediatype":
+        return f + " is not a valid media type"
+    }
+    return f + " is invalid"
+}
+
+// normalizer is implemented by payloads that tidy themselves (trimming,
+// defaults) before their tags are checked.
+type normalizer interface {
+    normalize()
+}
+
+// normalizeSpace trims s and collapses each inner run of whitespace to one
+// space. Every single-line text input (names, titles, filenames, assignees)
+// goes through it, so values that look the same are stored the same and a
+// blank one fails "required". Free text such as comment bodies is only
+// trimmed, keeping its line breaks.
+func normalizeSpace(s string) string {
+    return strings.Join(strings.Fields(s), " ")
+}
+
+// checkPayload normalizes v if it can and then validates it.
+func checkPayload(v any) error {
+    if n, ok := v.(normalizer); ok {
+        n.normalize()
+    }
+    return validateStruct(v)
+}
+
+// decodeValid decodes a JSON body into dst as decodeJSON does and runs
+// checkPayload on it. On failure it has already written the error response,
+// a 400 listing every failing field for a payload that doesn't validate.
+func decodeValid(w http.ResponseWriter, r *http.Request, dst any) bool {
+    if !decodeJSON(w, r, dst) {
+        return false
+    }
+    if err := checkPayload(dst); err != nil {
+        validationFailed(w, err)
+        return false
+    }
+    return true
+}
+
+// validationFailed writes the 400 for a payload that failed validation. A
+// validationError's fields are listed under "details" alongside the joined
+// message.
+func validationFailed(w http.ResponseWriter, err error) {
+    d := newErrorDetail(w, CodeValidationFailed, err.Error())
+    var ve validationError
+    if errors.As(err, &ve) {
+        d.Details = ve
+    }
+    writeJSON(w, 400, errorBody{Error: d})
+}
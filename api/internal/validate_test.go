@@ -0,0 +1,44 @@
+package internal
+
+import (
+    "errors"
+    "strings"
+    "testing"
+)
+
+func TestLengthTags(t *testing.T) {
+    long := func(n int) string { return strings.Repeat("é", n) }
+    in := CustomerInput{Name: long(maxNameLen + 1)}
+    err := checkPayload(&in)
+    var ve validationError
+    if !errors.As(err, &ve) || len(ve) != 1 {
+        t.Fatalf("got %v, want one field error", err)
+    }
+    if want := "name must be at most 200 characters"; ve[0].Field != "name" || ve[0].Message != want {
+        t.Errorf("got %+v, want name: %q", ve[0], want)
+    }
+    // The limit counts characters, so a multi-byte name at it passes.
+    if err := checkPayload(&CustomerInput{Name: long(maxNameLen)}); err != nil {
+        t.Errorf("a name of %d characters: %v", maxNameLen, err)
+    }
+
+    for _, tc := range []struct {
+        schema map[string]any
+        field  string
+        max    int
+    }{
+        {schemaFor(CustomerInput{}), "name", maxNameLen},
+        {schemaFor(CustomerInput{}), "email", maxEmailLen},
+        {schemaFor(caseInput{}), "title", maxTitleLen},
+        {schemaFor(commentInput{}), "body", maxCommentLen},
+        {schemaFor(attachmentInput{}), "filename", maxFilenameLen},
+        {schemaFor(attachmentInput{}), "content_type", maxContentTypeLen},
+        {schemaFor(attachmentInput{}), "url", maxURLLen},
+    } {
+        props, _ := tc.schema["properties"].(map[string]any)
+        prop, _ := props[tc.field].(map[string]any)
+        if got := prop["maxLength"]; got != tc.max {
+            t.Errorf("%s: maxLength %v, want %d", tc.field, got, tc.max)
+        }
+    }
+}
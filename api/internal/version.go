@@ -0,0 +1,24 @@
+package internal
+
+import (
+    "net/http"
+    "runtime"
+)
+
+// Build information, set at link time:
+//
+//    go build -ldflags "-X example.com/api/internal.Commit=$(git rev-parse HEAD) -X example.com/api/internal.BuildTime=$(date -u +%FT%TZ)"
+var (
+    Commit    = "dev"
+    BuildTime = "unknown"
+)
+
+// Version reports which build is running, so a deploy can be confirmed
+// from outside.
+func (h *Handler) Version(w http.ResponseWriter, r *http.Request) {
+    writeJSON(w, http.StatusOK, map[string]string{
+        "commit":     Commit,
+        "build_time": BuildTime,
+        "go_version": runtime.Version(),
+    })
+}
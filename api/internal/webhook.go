@@ -0,0 +1,167 @@
+package internal
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "strconv"
+    "time"
+)
+
+const (
+    // webhookQueueSize is how many events may wait for delivery; past it new
+    // events are dropped (and logged) rather than blocking a request.
+    webhookQueueSize = 1000
+    // webhookTimeout bounds one delivery attempt.
+    webhookTimeout = 10 * time.Second
+    // webhookBaseDelay is the wait before the first retry, doubling up to
+    // webhookMaxDelay.
+    webhookBaseDelay = time.Second
+    webhookMaxDelay  = time.Minute
+)
+
+// Webhook signature headers. The signature is the hex HMAC-SHA256, keyed
+// with WEBHOOK_SECRET, of the timestamp, a ".", and the body, so a receiver
+// can both verify a delivery and reject an old one replayed.
+const (
+    webhookSignatureHeader = "X-Webhook-Signature"
+    webhookTimestampHeader = "X-Webhook-Timestamp"
+)
+
+// webhookEvent is the JSON body POSTed for each case event. ID is the same
+// on every attempt, so receivers can drop duplicate deliveries.
+type webhookEvent struct {
+    ID    string    `json:"id"`
+    Type  string    `json:"type"`
+    OrgID int       `json:"org_id"`
+    At    time.Time `json:"created_at"`
+    Case  Case      `json:"case"`
+    // PreviousStatus is set on case.status_changed.
+    PreviousStatus string `json:"previous_status,omitempty"`
+}
+
+// Webhooks delivers case events to Config.WebhookURL from a single worker,
+// so sending never blocks the request that caused the event. A failed
+// delivery (a transport error or a non-2xx response) is retried with
+// backoff up to Config.WebhookMaxAttempts attempts and then dropped. A nil
+// *Webhooks, as NewWebhooks returns when no URL is configured, ignores
+// events.
+type Webhooks struct {
+    url      string
+    secret   []byte
+    attempts int
+    client   *http.Client
+    queue    chan webhookEvent
+}
+
+// NewWebhooks returns the dispatcher for cfg, or nil when WEBHOOK_URL is
+// unset. Run must be started for events to go out.
+func NewWebhooks(cfg *Config) *Webhooks {
+    if cfg.WebhookURL == "" {
+        return nil
+    }
+    return &Webhooks{
+        url:      cfg.WebhookURL,
+        secret:   []byte(cfg.WebhookSecret),
+        attempts: cfg.WebhookMaxAttempts,
+        client:   &http.Client{Timeout: webhookTimeout},
+        queue:    make(chan webhookEvent, webhookQueueSize),
+    }
+}
+
+// caseCreated queues a case.created event for c.
+func (wh *Webhooks) caseCreated(ctx context.Context, c Case) {
+    wh.send(ctx, webhookEvent{Type: "case.created", Case: c})
+}
+
+// caseStatusChanged queues a case.status_changed event for a case that
+// moved from the status in before to the one in after.
+func (wh *Webhooks) caseStatusChanged(ctx context.Context, before, after Case) {
+    wh.send(ctx, webhookEvent{Type: "case.status_changed", Case: after, PreviousStatus: before.Status})
+}
+
+func (wh *Webhooks) send(ctx context.Context, ev webhookEvent) {
+    if wh == nil {
+        return
+    }
+    ev.ID, ev.OrgID, ev.At = newUUID(), orgFromContext(ctx), time.Now().UTC()
+    select {
+    case wh.queue <- ev:
+    default:
+        logRequest(RequestIDFromContext(ctx), "webhook: queue full, dropped %s event %s for case %d", ev.Type, ev.ID, ev.Case.ID)
+    }
+}
+
+// Run delivers queued events, one at a time and in order, until ctx is
+// done; events still queued then are not sent.
+func (wh *Webhooks) Run(ctx context.Context) {
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case ev := <-wh.queue:
+            wh.deliver(ctx, ev)
+        }
+    }
+}
+
+// deliver POSTs ev, retrying failures with backoff.
+func (wh *Webhooks) deliver(ctx context.Context, ev webhookEvent) {
+    body, err := json.Marshal(ev)
+    if err != nil {
+        log.Printf("webhook: encode %s event %s: %v", ev.Type, ev.ID, err)
+        return
+    }
+    delay := webhookBaseDelay
+    for attempt := 1; ; attempt++ {
+        err := wh.post(ctx, body)
+        if err == nil {
+            return
+        }
+        if attempt == wh.attempts {
+            log.Printf("webhook: giving up on %s event %s after %d attempts: %v", ev.Type, ev.ID, attempt, err)
+            return
+        }
+        log.Printf("webhook: %s event %s attempt %d/%d failed: %v; retrying in %s", ev.Type, ev.ID, attempt, wh.attempts, err, delay)
+        select {
+        case <-ctx.Done():
+            return
+        case <-time.After(delay):
+        }
+        delay = min(delay*2, webhookMaxDelay)
+    }
+}
+
+func (wh *Webhooks) post(ctx context.Context, body []byte) error {
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.url, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    ts := strconv.FormatInt(time.Now().Unix(), 10)
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set(webhookTimestampHeader, ts)
+    req.Header.Set(webhookSignatureHeader, "sha256="+webhookSignature(wh.secret, ts, body))
+    resp, err := wh.client.Do(req)
+    if err != nil {
+        return err
+    }
+    resp.Body.Close()
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        return fmt.Errorf("receiver answered %s", resp.Status)
+    }
+    return nil
+}
+
+// webhookSignature signs ts and body as the signature header describes.
+func webhookSignature(secret []byte, ts string, body []byte) string {
+    mac := hmac.New(sha256.New, secret)
+    mac.Write([]byte(ts + "."))
+    mac.Write(body)
+    return hex.EncodeToString(mac.Sum(nil))
+}
@@ -1,52 +1,251 @@
 package main
 
 import (
+    "context"
+    "database/sql"
+    "errors"
     "log"
     "net/http"
     "os"
+    "os/signal"
+    "syscall"
     "time"
 
     "example.com/api/internal"
     _ "github.com/go-sql-driver/mysql"
     "github.com/gorilla/mux"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
-    db, err := internal.OpenDB()
+    cfg, err := internal.LoadConfig()
+    if err != nil {
+        log.Fatal(err)
+    }
+    // Logged before connecting, so a deploy that can't reach the DB still
+    // shows what it was configured with.
+    internal.LogConfig(cfg)
+
+    // Tracing is set up first so the DB pools are opened traced.
+    shutdownTracing, err := internal.InitTracing(context.Background(), cfg)
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    breaker := internal.NewBreaker("primary", cfg.DBBreakerThreshold, cfg.DBBreakerCooldown)
+    db, err := internal.OpenDB(cfg, breaker)
     if err != nil {
         log.Fatal(err)
     }
     defer db.Close()
 
-    db.SetConnMaxLifetime(2 * time.Minute)
-    db.SetMaxOpenConns(10)
-    db.SetMaxIdleConns(5)
+    replicaBreaker := internal.NewBreaker("replica", cfg.DBBreakerThreshold, cfg.DBBreakerCooldown)
+    replica, err := internal.OpenReplica(cfg, replicaBreaker)
+    if err != nil {
+        log.Fatal(err)
+    }
+    if replica != nil {
+        defer replica.Close()
+    }
+
+    // The replica, if any, gets the same pool settings as the primary.
+    for _, d := range []*sql.DB{db, replica} {
+        if d == nil {
+            continue
+        }
+        d.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+        d.SetMaxOpenConns(cfg.DBMaxOpenConns)
+        d.SetMaxIdleConns(cfg.DBMaxIdleConns)
+    }
+    log.Printf("db pool: max_open=%d max_idle=%d conn_max_lifetime=%s replica=%t",
+        cfg.DBMaxOpenConns, cfg.DBMaxIdleConns, cfg.DBConnMaxLifetime, replica != nil)
+
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
+
+    if err := internal.WaitForDB(ctx, db, cfg.DBConnectAttempts, cfg.DBConnectBaseDelay); err != nil {
+        log.Fatal(err)
+    }
+    if replica != nil {
+        if err := internal.WaitForDB(ctx, replica, cfg.DBConnectAttempts, cfg.DBConnectBaseDelay); err != nil {
+            log.Fatal(err)
+        }
+    }
+    if cfg.RunMigrations {
+        if err := internal.Migrate(ctx, db); err != nil {
+            log.Fatal(err)
+        }
+    }
+
+    internal.RegisterDBMetrics(db, cfg.DBName)
+    if replica != nil {
+        internal.RegisterDBMetrics(replica, cfg.DBName+"_replica")
+    }
+
+    customers, err := internal.NewCustomerRepo(ctx, db, replica, cfg.DBTxAttempts)
+    if err != nil {
+        log.Fatal(err)
+    }
+    defer customers.Close()
+    if cfg.EnablePurge {
+        go internal.RunPurge(ctx, customers, cfg.PurgeInterval, cfg.PurgeRetention)
+    }
 
-    h := &internal.Handler{DB: db}
+    maintenance := internal.NewMaintenance(cfg.MaintenanceMode)
+    if cfg.MaintenanceMode {
+        log.Println("starting in maintenance mode; writes are disabled")
+    }
+    webhooks := internal.NewWebhooks(cfg)
+    if webhooks != nil {
+        go webhooks.Run(ctx)
+    }
+    h := &internal.Handler{DB: db, Replica: replica, Breaker: breaker, ReplicaBreaker: replicaBreaker, Config: cfg, Customers: customers, Maintenance: maintenance, Webhooks: webhooks}
     r := mux.NewRouter()
 
     r.HandleFunc("/api/health", h.Health).Methods("GET")
+    r.HandleFunc("/api/ready", h.Ready).Methods("GET")
+    r.HandleFunc("/api/version", h.Version).Methods("GET")
+    r.Handle("/metrics", promhttp.Handler()).Methods("GET")
+    r.HandleFunc("/api/openapi.json", h.OpenAPI).Methods("GET")
+    r.HandleFunc("/api/docs", h.Docs).Methods("GET")
     r.HandleFunc("/api/customers", h.ListCustomers).Methods("GET")
+    r.HandleFunc("/api/customers", h.HeadCustomers).Methods("HEAD")
+    r.HandleFunc("/api/customers.csv", h.ExportCustomersCSV).Methods("GET")
+    r.HandleFunc("/api/customers", h.CreateCustomer).Methods("POST")
+    r.HandleFunc("/api/customers/bulk", h.BulkCreateCustomers).Methods("POST")
+    // Registered before /api/customers/{id} so "count" isn't taken as an id.
+    r.HandleFunc("/api/customers/count", h.CountCustomers).Methods("GET")
+    r.HandleFunc("/api/customers/{id}", h.GetCustomer).Methods("GET")
+    r.HandleFunc("/api/customers/{id}", h.UpdateCustomer).Methods("PUT")
+    r.HandleFunc("/api/customers/{id}", h.PatchCustomer).Methods("PATCH")
+    r.HandleFunc("/api/customers/{id}", h.DeleteCustomer).Methods("DELETE")
+    r.HandleFunc("/api/customers/{id}/restore", h.RestoreCustomer).Methods("POST")
+    r.HandleFunc("/api/customers/{id}/merge", h.MergeCustomer).Methods("POST")
+    r.HandleFunc("/api/customers/{id}/cases", h.ListCustomerCases).Methods("GET")
+    r.HandleFunc("/api/customers/{id}/timeline", h.CustomerTimeline).Methods("GET")
+    r.HandleFunc("/api/cases", h.ListCases).Methods("GET")
+    r.HandleFunc("/api/cases", h.CreateCase).Methods("POST")
+    r.HandleFunc("/api/cases/bulk-status", h.BulkUpdateCaseStatus).Methods("POST")
+    r.HandleFunc("/api/cases/stream", h.StreamCases).Methods("GET")
+    r.HandleFunc("/api/cases/stats", h.CaseStatusCounts).Methods("GET")
+    r.HandleFunc("/api/cases/{id}/status", h.UpdateCaseStatus).Methods("PATCH")
+    r.HandleFunc("/api/cases/{id}/priority", h.UpdateCasePriority).Methods("PATCH")
+    r.HandleFunc("/api/cases/{id}/due", h.SetCaseDue).Methods("PATCH")
+    r.HandleFunc("/api/cases/{id}/metadata", h.SetCaseMetadata).Methods("PATCH")
+    r.HandleFunc("/api/cases/{id}/assignee", h.AssignCase).Methods("PUT")
+    r.HandleFunc("/api/cases/{id}/assignee", h.UnassignCase).Methods("DELETE")
+    r.HandleFunc("/api/cases/{id}/comments", h.ListComments).Methods("GET")
+    r.HandleFunc("/api/cases/{id}/comments", h.CreateComment).Methods("POST")
+    r.HandleFunc("/api/cases/{id}/attachments", h.ListAttachments).Methods("GET")
+    r.HandleFunc("/api/cases/{id}/attachments", h.CreateAttachment).Methods("POST")
+    r.HandleFunc("/api/search", h.Search).Methods("GET")
+    r.HandleFunc("/api/stats", h.Stats).Methods("GET")
+    r.HandleFunc("/api/admin/db-stats", h.DBStats).Methods("GET")
+    r.HandleFunc("/api/admin/audit", h.ListAudit).Methods("GET")
+    r.HandleFunc("/api/admin/stats/refresh", h.RefreshStats).Methods("POST")
+    r.HandleFunc("/api/admin/maintenance", h.GetMaintenance).Methods("GET")
+    r.HandleFunc("/api/admin/maintenance", h.SetMaintenance).Methods("PUT")
+    r.MethodNotAllowedHandler = internal.MethodNotAllowed(r)
 
-    port := getenv("PORT", "8081")
-    log.Println("API listening on :" + port)
-    log.Fatal(http.ListenAndServe(":"+port, cors(r)))
-}
+    // API keys are tried before JWTs: they're cheaper to check.
+    var auths []internal.Authenticator
+    if len(cfg.APIKeys) > 0 || len(cfg.AdminAPIKeys) > 0 {
+        auths = append(auths, internal.NewAPIKeys(cfg.APIKeys, cfg.AdminAPIKeys, cfg.APIKeyOrgs))
+    }
+    if jwtAuth := internal.NewJWTAuth(cfg); jwtAuth != nil {
+        auths = append(auths, jwtAuth)
+    }
+    if len(auths) == 0 {
+        log.Println("warning: none of API_KEYS, ADMIN_API_KEYS, JWT_SECRET or JWT_JWKS_URL is set; authentication is disabled")
+    }
 
-func getenv(k, def string) string {
-    if v := os.Getenv(k); v != "" { return v }
-    return def
+    limiter := internal.NewRateLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst)
+    go limiter.Run(ctx)
+
+    // Middleware, innermost first. The rate limiter runs behind auth so it
+    // can key on the API key; auth runs behind CORS so preflight OPTIONS
+    // requests are answered without a key; gzip sits inside the metrics and
+    // logging wrappers so they see the real status and bytes on the wire;
+    // logging sits near the outside so preflights are logged too, inside the
+    // request ID so every line carries it. The timeout wraps only the routed
+    // handlers, so its 503 still passes through every other layer. The null
+    // policy wraps the router directly so handlers write through it. The
+    // maintenance guard sits outside the timeout so refused writes never
+    // start a handler. The per-route concurrency limit sits inside the
+    // timeout so a slot is held until the handler really finishes. Tracing
+    // is outermost so the request's span covers every layer.
+    var handler http.Handler = r
+    handler = internal.NullPolicy(handler, cfg.JSONNulls)
+    handler = internal.NoStore(handler)
+    handler = internal.Recover(handler)
+    handler = internal.LimitConcurrency(handler, r, cfg.RouteConcurrency, cfg.RouteConcurrencyWait)
+    handler = internal.Timeout(handler, cfg.RequestTimeout)
+    handler = maintenance.Guard(handler)
+    handler = limiter.Limit(handler)
+    handler = internal.RequireAuth(handler, auths...)
+    handler = cors(handler, cfg.CORSAllowedOrigins)
+    handler = internal.Gzip(handler)
+    handler = internal.Instrument(handler, r)
+    handler = internal.LogRequests(handler, cfg.LogFormat)
+    handler = internal.RequestID(handler)
+    handler = internal.Trace(handler, r)
+    srv := &http.Server{Addr: ":" + cfg.Port, Handler: handler}
+    srv.RegisterOnShutdown(h.CloseStreams)
+
+    go func() {
+        var err error
+        if cfg.TLSCertFile != "" {
+            srv.TLSConfig = internal.ServerTLSConfig()
+            log.Println("API listening with TLS on :" + cfg.Port)
+            err = srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+        } else {
+            log.Println("API listening on :" + cfg.Port)
+            err = srv.ListenAndServe()
+        }
+        if err != nil && !errors.Is(err, http.ErrServerClosed) {
+            log.Fatal(err)
+        }
+    }()
+
+    <-ctx.Done()
+    stop()
+    log.Println("shutdown signal received, draining connections")
+
+    start := time.Now()
+    shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+    defer cancel()
+    if err := srv.Shutdown(shutdownCtx); err != nil {
+        log.Printf("shutdown: %v", err)
+    }
+    log.Printf("drained in %.2fs", time.Since(start).Seconds())
+    if err := shutdownTracing(shutdownCtx); err != nil {
+        log.Printf("shutdown tracing: %v", err)
+    }
 }
 
-func cors(h http.Handler) http.Handler {
+// cors allows cross-origin requests only from the given origins. A matching
+// Origin is echoed back with credentials allowed; any other origin gets no
+// CORS headers, so browsers reject the response. An empty list denies all
+// cross-origin access.
+func cors(h http.Handler, origins []string) http.Handler {
+    allowed := map[string]bool{}
+    for _, o := range origins {
+        allowed[o] = true
+    }
+
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        w.Header().Set("Access-Control-Allow-Origin","*")
-        w.Header().Set("Access-Control-Allow-Headers","Content-Type, Authorization")
-        w.Header().Set("Access-Control-Allow-Methods","GET, POST, PUT, PATCH, DELETE, OPTIONS")
+        w.Header().Add("Vary", "Origin")
+        if origin := r.Header.Get("Origin"); allowed[origin] {
+            w.Header().Set("Access-Control-Allow-Origin", origin)
+            w.Header().Set("Access-Control-Allow-Credentials", "true")
+            w.Header().Set("Access-Control-Allow-Headers","Content-Type, Authorization, X-Request-ID, Idempotency-Key, If-None-Match, If-Unmodified-Since, If-Modified-Since, traceparent, tracestate")
+            w.Header().Set("Access-Control-Allow-Methods","GET, POST, PUT, PATCH, DELETE, OPTIONS")
+            w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count, X-Request-ID, ETag, Last-Modified, Retry-After")
+        }
         if r.Method == http.MethodOptions {
             w.WriteHeader(http.StatusNoContent)
             return
         }
         h.ServeHTTP(w, r)
     })
-}
\ No newline at end of file
+}
@@ -16,7 +16,7 @@ export default function App(){
   useEffect(() => {
     fetch(`${API}/api/customers`)
       .then(r => r.json())
-      .then(setData)
+      .then(p => setData(p.data))
       .finally(() => setLoading(false))
   },[])
 